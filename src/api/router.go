@@ -1,8 +1,12 @@
 package api
 
 import (
+	"budgee-server/src/config"
 	"budgee-server/src/handlers"
+	"budgee-server/src/mailer"
 	"budgee-server/src/middleware"
+	"budgee-server/src/models"
+	"budgee-server/src/oidc"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -10,83 +14,222 @@ import (
 	"github.com/plaid/plaid-go/v41/plaid"
 )
 
-func NewRouter(pool *pgxpool.Pool, plaidClient *plaid.APIClient, plaidEnv string, isDemo bool) *chi.Mux {
+func NewRouter(pool *pgxpool.Pool, plaidClient *plaid.APIClient, mail mailer.Mailer, cfg config.Config) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.CORSMiddleware)
 
+	oidcProviders := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		oidcProviders[p.Name] = oidc.NewProvider(oidc.ProviderConfig(p))
+	}
+
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("ok"))
 	})
+	r.Get("/.well-known/jwks.json", handlers.GetJWKS())
 
 	r.Route("/api", func(r chi.Router) {
-		r.Post("/login", handlers.Login(pool))
-		r.Post("/register", handlers.Register(pool))
+		r.Post("/login", handlers.Login(pool, cfg.LoginThrottle, mail))
+		r.Post("/login/mfa", handlers.LoginMFA(pool, cfg.LoginThrottle, mail))
+		r.Post("/register", handlers.Register(pool, mail, cfg.AppBaseURL))
+		r.Post("/email/verify", handlers.VerifyEmail(pool))
+		r.Post("/token/refresh", handlers.RefreshToken(pool))
+		r.Post("/password-reset/request", handlers.RequestPasswordReset(pool, mail, cfg.AppBaseURL))
+		r.Post("/password-reset/confirm", handlers.ConfirmPasswordReset(pool))
+		r.Post("/auth/oidc/{provider}/start", handlers.StartOIDCLogin(pool, oidcProviders))
+		r.Post("/auth/oidc/{provider}/callback", handlers.OIDCCallback(pool, oidcProviders, mail))
 		r.Post("/plaid/webhook", handlers.PlaidWebhook(plaidClient, pool))
-		if plaidEnv == "sandbox" {
+		if cfg.PlaidEnvironment == "sandbox" {
 			r.Post("/plaid/sandbox/fire_webhook", handlers.FireSandboxWebhook(plaidClient, pool))
 		}
 
-		// Protected routes
-		r.With(middleware.JWTAuthMiddleware(pool), middleware.DemoModeMiddleware(isDemo)).Group(func(r chi.Router) {
-			// User
-			r.Get("/user/{user_id}", handlers.GetUser(pool))
-			r.Put("/user", handlers.UpdateUser(pool))
-			r.Post("/user/change-password", handlers.ChangePassword(pool))
-			r.Delete("/user", handlers.DeleteUser(pool))
+		// Protected routes. Interactive sessions reach every route below, personal API tokens only the scoped groups.
+		// Until the email is verified only account management is available.
+		r.With(middleware.JWTAuthMiddleware(pool), middleware.DemoModeMiddleware(cfg.IsDemo)).Group(func(r chi.Router) {
+			// Account management is never available to API tokens
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.SessionOnlyMiddleware)
 
-			// Plaid
-			r.Post("/plaid/create-link-token", handlers.CreateLinkToken(plaidClient, pool))
-			r.Post("/plaid/exchange-public-token", handlers.ExchangePublicToken(plaidClient, pool))
-			r.Get("/plaid/items", handlers.GetPlaidItemsSQL(pool))
-			r.Get("/plaid/accounts/{item_id}", handlers.GetPlaidAccounts(plaidClient, pool))
-			r.Get("/plaid/accounts/{item_id}/db", handlers.GetAccountsSQL(pool))
-			r.Get("/plaid/transactions/{item_id}/sync", handlers.SyncTransactions(plaidClient, pool))
-			r.Get("/plaid/transactions/{account_id}", handlers.GetTransactionsSQL(pool))
-			r.Post("/plaid/transactions", handlers.CreateTransaction(pool))
-			r.Delete("/plaid/items/{item_id}", handlers.DeletePlaidItem(plaidClient, pool))
-			r.Put("/plaid/transactions/{transaction_id}", handlers.UpdateTransaction(pool))
-			r.Delete("/plaid/transactions/{transaction_id}", handlers.DeleteTransaction(pool))
-
-			// Budget
-			r.Post("/budgets", handlers.CreateBudget(pool))
-			r.Get("/budgets", handlers.GetAllBudgetsForUser(pool))
-			r.Get("/budgets/{budget_id}", handlers.GetBudgetByID(pool))
-			r.Get("/budgets/category/{category}", handlers.GetBudgetByCategory(pool))
-			r.Put("/budgets/{budget_id}", handlers.UpdateBudget(pool))
-			r.Delete("/budgets/{budget_id}", handlers.DeleteBudget(pool))
-
-			// Transaction Rules
-			r.Post("/transaction-rules", handlers.CreateTransactionRule(pool))
-			r.Post("/transaction-rules/trigger", handlers.TriggerTransactionRules(pool))
-			r.Get("/transaction-rules", handlers.GetAllTransactionRules(pool))
-			r.Get("/transaction-rules/{rule_id}", handlers.GetTransactionRuleByID(pool))
-			r.Put("/transaction-rules/{rule_id}", handlers.UpdateTransactionRule(pool))
-			r.Delete("/transaction-rules/{rule_id}", handlers.DeleteTransactionRule(pool))
+				// Session
+				r.Post("/logout", handlers.Logout(pool))
+				r.Post("/logout/all", handlers.LogoutAll(pool))
+
+				// User
+				r.Get("/user/{user_id}", handlers.GetUser(pool))
+				r.Put("/user", handlers.UpdateUser(pool, mail, cfg.AppBaseURL))
+				r.Post("/user/change-password", handlers.ChangePassword(pool))
+				r.Delete("/user", handlers.DeleteUser(pool, mail, cfg.AccountDeletionGracePeriod))
+				r.Post("/user/deletion/cancel", handlers.CancelAccountDeletion(pool))
+				r.Get("/user/export", handlers.ExportUserData(pool))
+
+				// Email verification
+				r.Post("/user/email/verification", handlers.ResendEmailVerification(pool, mail, cfg.AppBaseURL))
+				r.Delete("/user/email/pending", handlers.CancelEmailChange(pool))
+
+				// Sessions and login history
+				r.Get("/user/sessions", handlers.GetLoginHistory(pool))
+				r.Delete("/user/sessions/{session_id}", handlers.RevokeUserSession(pool))
+
+				// Two-factor authentication
+				r.Post("/user/mfa/enroll", handlers.EnrollTOTP(pool))
+				r.Post("/user/mfa/confirm", handlers.ConfirmTOTP(pool))
+				r.Post("/user/mfa/disable", handlers.DisableTOTP(pool))
+				r.Post("/user/mfa/recovery-codes", handlers.RegenerateRecoveryCodes(pool))
+
+				// Single sign-on identities
+				r.Get("/user/identities", handlers.GetUserIdentities(pool))
+				r.Delete("/user/identities/{identity_id}", handlers.UnlinkUserIdentity(pool))
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.VerifiedEmailMiddleware)
+
+					// API tokens
+					r.Post("/user/api-tokens", handlers.CreateAPIToken(pool))
+					r.Get("/user/api-tokens", handlers.GetAPITokens(pool))
+					r.Delete("/user/api-tokens/{token_id}", handlers.RevokeAPIToken(pool))
+
+					// Plaid
+					r.Post("/plaid/create-link-token", handlers.CreateLinkToken(plaidClient, pool))
+					r.Post("/plaid/exchange-public-token", handlers.ExchangePublicToken(plaidClient, pool))
+					r.Delete("/plaid/items/{item_id}", handlers.DeletePlaidItem(plaidClient, pool))
+					r.Post("/plaid/items/{item_id}/link-token", handlers.CreateUpdateLinkToken(plaidClient, pool))
+					r.Post("/plaid/items/{item_id}/update-complete", handlers.CompleteItemUpdate(plaidClient, pool))
+				})
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.VerifiedEmailMiddleware)
+
+				// Accounts
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeAccountsRead))
+					r.Get("/plaid/items", handlers.GetPlaidItemsSQL(pool))
+					r.Get("/plaid/accounts/{item_id}", handlers.GetPlaidAccounts(plaidClient, pool))
+					r.Get("/plaid/accounts/{item_id}/db", handlers.GetAccountsSQL(pool))
+				})
+
+				// Transactions
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeTransactionsRead))
+					r.Get("/plaid/transactions/{account_id}", handlers.GetTransactionsSQL(pool))
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeTransactionsWrite))
+					r.Get("/plaid/transactions/{item_id}/sync", handlers.SyncTransactions(plaidClient, pool))
+					r.Post("/plaid/transactions", handlers.CreateTransaction(pool))
+					r.Put("/plaid/transactions/{transaction_id}", handlers.UpdateTransaction(pool))
+					r.Delete("/plaid/transactions/{transaction_id}", handlers.DeleteTransaction(pool))
+					r.Post("/plaid/transactions/{transaction_id}/reset", handlers.ResetTransactionOverrides(pool))
+				})
+
+				// Recurring streams
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeTransactionsRead))
+					r.Get("/recurring", handlers.GetRecurringStreams(pool))
+					r.Get("/recurring/upcoming", handlers.GetUpcomingRecurringCharges(pool))
+					r.Get("/recurring/changes", handlers.GetRecurringChanges(pool))
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeTransactionsWrite))
+					r.Post("/recurring/detect", handlers.DetectRecurringStreams(plaidClient, pool, cfg.PlaidRecurring))
+				})
+
+				// Investments
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeInvestmentsRead))
+					r.Get("/investments/holdings", handlers.GetHoldings(pool))
+					r.Get("/investments/transactions", handlers.GetInvestmentTransactions(pool))
+					r.Get("/investments/value", handlers.GetPortfolioValue(pool))
+					r.Get("/investments/allocation", handlers.GetInvestmentAllocation(pool))
+					r.Get("/investments/cost-basis", handlers.GetCostBasis(pool))
+				})
+
+				// Liabilities
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeLiabilitiesRead))
+					r.Get("/liabilities", handlers.GetLiabilities(pool))
+				})
+
+				// Budget
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeBudgetsRead))
+					r.Get("/budgets", handlers.GetAllBudgetsForUser(pool))
+					r.Get("/budgets/{budget_id}", handlers.GetBudgetByID(pool))
+					r.Get("/budgets/category/{category}", handlers.GetBudgetByCategory(pool))
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeBudgetsWrite))
+					r.Post("/budgets", handlers.CreateBudget(pool))
+					r.Put("/budgets/{budget_id}", handlers.UpdateBudget(pool))
+					r.Delete("/budgets/{budget_id}", handlers.DeleteBudget(pool))
+				})
+
+				// Transaction Rules
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeRulesRead))
+					r.Get("/transaction-rules", handlers.GetAllTransactionRules(pool))
+					r.Get("/transaction-rules/{rule_id}", handlers.GetTransactionRuleByID(pool))
+				})
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireScope(models.ScopeRulesWrite))
+					r.Post("/transaction-rules", handlers.CreateTransactionRule(pool))
+					r.Post("/transaction-rules/trigger", handlers.TriggerTransactionRules(pool))
+					r.Put("/transaction-rules/{rule_id}", handlers.UpdateTransactionRule(pool))
+					r.Delete("/transaction-rules/{rule_id}", handlers.DeleteTransactionRule(pool))
+				})
+			})
 		})
 
-		// Super Admin Routes
-		r.With(middleware.JWTAuthMiddleware(pool), middleware.SuperAdminMiddleware).Group(func(r chi.Router) {
+		// Admin Routes, each guarded by the permission it needs. Every change made here is written to the audit log.
+		r.With(middleware.JWTAuthMiddleware(pool), middleware.StaffMiddleware(pool), middleware.AuditMiddleware(pool)).Group(func(r chi.Router) {
 			// User
-			r.Get("/admin/users", handlers.GetAllUsers(pool))
-			r.Put("/admin/user/{user_id}", handlers.AdminUpdateUser(pool))
-			r.Delete("/admin/user/{user_id}", handlers.AdminDeleteUser(pool))
-			r.Post("/admin/user/lock/{user_id}", handlers.LockUser(pool))
-			r.Post("/admin/user/unlock/{user_id}", handlers.UnlockUser(pool))
+			r.With(middleware.RequirePermission(models.PermUsersRead)).Get("/admin/users", handlers.GetAllUsers(pool))
+			r.With(middleware.RequirePermission(models.PermUsersWrite)).Put("/admin/user/{user_id}", handlers.AdminUpdateUser(pool))
+			r.With(middleware.RequirePermission(models.PermUsersDelete)).Delete("/admin/user/{user_id}", handlers.AdminDeleteUser(plaidClient, pool))
+			r.With(middleware.RequirePermission(models.PermUsersWrite)).Post("/admin/user/lock/{user_id}", handlers.LockUser(pool))
+			r.With(middleware.RequirePermission(models.PermUsersWrite)).Post("/admin/user/unlock/{user_id}", handlers.UnlockUser(pool))
+			r.With(middleware.RequirePermission(models.PermUsersRead)).Get("/admin/user/login-failures/{user_id}", handlers.GetUserLoginFailures(pool))
+			r.With(middleware.RequirePermission(models.PermUsersWrite)).Delete("/admin/user/login-failures/{user_id}", handlers.ClearUserLoginFailures(pool))
+			r.With(middleware.RequirePermission(models.PermUsersRead)).Get("/admin/login-failures", handlers.GetAllLoginFailures(pool))
+			r.With(middleware.RequirePermission(models.PermUsersWrite)).Delete("/admin/login-failures/ip/{ip_address}", handlers.ClearIPLoginFailures(pool))
 
 			// Plaid
-			r.Post("/item/webhook/update-all", handlers.UpdateAllItemWebhooks(plaidClient, pool))
-			r.Post("/plaid/transactions/recategorize", handlers.RecategorizeTransactions(plaidClient, pool))
-			r.Post("/plaid/transactions/sync/{user_id}", handlers.SyncTransactionsForUser(plaidClient, pool))
-			r.Get("/plaid/items/all/db", handlers.GetAllPlaidItemsSQL(pool))
-			r.Delete("/admin/plaid/items/{item_id}", handlers.AdminDeletePlaidItem(plaidClient, pool))
+			r.With(middleware.RequirePermission(models.PermItemsWrite)).Post("/item/webhook/update-all", handlers.UpdateAllItemWebhooks(plaidClient, pool))
+			r.With(middleware.RequirePermission(models.PermSyncTrigger)).Post("/plaid/transactions/recategorize", handlers.RecategorizeTransactions(plaidClient, pool))
+			r.With(middleware.RequirePermission(models.PermSyncTrigger)).Post("/plaid/transactions/sync/{user_id}", handlers.SyncTransactionsForUser(plaidClient, pool))
+			r.With(middleware.RequirePermission(models.PermItemsRead)).Get("/plaid/items/all/db", handlers.GetAllPlaidItemsSQL(pool))
+			r.With(middleware.RequirePermission(models.PermItemsDelete)).Delete("/admin/plaid/items/{item_id}", handlers.AdminDeletePlaidItem(plaidClient, pool))
 
 			// Cache
-			r.Post("/admin/cache/clear/{cache_name}", handlers.ClearCache(pool))
+			r.With(middleware.RequirePermission(models.PermCacheClear)).Post("/admin/cache/clear/{cache_name}", handlers.ClearCache(pool))
+
+			// Invitations
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermInvitationsManage))
+				r.Post("/admin/invitations", handlers.CreateInvitation(pool))
+				r.Get("/admin/invitations", handlers.GetInvitations(pool))
+				r.Delete("/admin/invitations/{invitation_id}", handlers.RevokeInvitation(pool))
+			})
+
+			// Background jobs
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermJobsManage))
+				r.Get("/admin/jobs", handlers.GetJobs(pool))
+				r.Post("/admin/jobs/{job_id}/retry", handlers.RetryJob(pool))
+				r.Post("/admin/jobs/{job_id}/cancel", handlers.CancelJob(pool))
+			})
+
+			// Audit
+			r.With(middleware.RequirePermission(models.PermAuditRead)).Get("/admin/audit-events", handlers.GetAuditEvents(pool))
 
-			// Whitelisted Emails
-			r.Post("/admin/whitelisted-emails", handlers.CreateWhitelistedEmail(pool))
-			r.Get("/admin/whitelisted-emails", handlers.GetAllWhitelistedEmails(pool))
-			r.Delete("/admin/whitelisted-emails/{email_id}", handlers.DeleteWhitelistedEmail(pool))
+			// Roles
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequirePermission(models.PermRolesManage))
+				r.Get("/admin/roles", handlers.GetRoles(pool))
+				r.Get("/admin/user/{user_id}/roles", handlers.GetUserRoles(pool))
+				r.Put("/admin/user/{user_id}/roles/{role}", handlers.AssignUserRole(pool))
+				r.Delete("/admin/user/{user_id}/roles/{role}", handlers.RemoveUserRole(pool))
+			})
 		})
 	})
 
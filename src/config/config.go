@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -10,10 +13,69 @@ import (
 type Config struct {
 	Port             string
 	DatabaseURL      string
+	DatabaseMaxConns int
 	PlaidClientID    string
 	PlaidSecret      string
 	PlaidEnvironment string
+	PlaidRecurring   bool
 	IsDemo           bool
+	AppBaseURL       string
+	MailDriver       string
+	MailFrom         string
+	MailLogFile      string
+	SMTPHost         string
+	SMTPPort         string
+	SMTPUsername     string
+	SMTPPassword     string
+	TrustedProxies   string
+	LoginThrottle    LoginThrottleConfig
+	EncryptionKeys   string
+	EncryptionKeyID  string
+	JWTSigningKeys   string
+	JWTVerifyKeys    string
+	JWTActiveKeyID   string
+	OIDCProviders    []OIDCProviderConfig
+
+	AccountDeletionGracePeriod time.Duration
+	Jobs                       JobQueueConfig
+	SyncSchedule               SyncScheduleConfig
+}
+
+// SyncScheduleConfig controls the periodic sync of every item. An Interval of zero disables it.
+type SyncScheduleConfig struct {
+	Interval      time.Duration
+	Concurrency   int
+	RatePerMinute int
+}
+
+// JobQueueConfig sizes the background job worker pool and its retry backoff
+type JobQueueConfig struct {
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+}
+
+// OIDCProviderConfig describes one external identity provider. RedirectURL is the frontend route that
+// receives the authorization code and hands it to /api/auth/oidc/{provider}/callback.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// LoginThrottleConfig controls the exponential backoff and automatic lockout applied to failed logins
+type LoginThrottleConfig struct {
+	FreeAttempts     int
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	BackoffBase      time.Duration
+	BackoffMax       time.Duration
+	FailureWindow    time.Duration
 }
 
 func Load() Config {
@@ -23,10 +85,48 @@ func Load() Config {
 	cfg := Config{
 		Port:             getEnv("PORT", "8080"),
 		DatabaseURL:      getEnv("DATABASE_URL", ""),
+		DatabaseMaxConns: getEnvInt("DATABASE_MAX_CONNS", 20),
 		PlaidClientID:    getEnv("PLAID_CLIENT_ID", ""),
 		PlaidSecret:      getEnv("PLAID_SECRET", ""),
 		PlaidEnvironment: getEnv("PLAID_ENVIRONMENT", "sandbox"),
+		PlaidRecurring:   getEnv("PLAID_RECURRING_ENABLED", "false") == "true",
 		IsDemo:           getEnv("IS_DEMO", "false") == "true",
+		AppBaseURL:       getEnv("APP_BASE_URL", "https://budgeeapp.com"),
+		MailDriver:       getEnv("MAIL_DRIVER", ""),
+		MailFrom:         getEnv("MAIL_FROM", ""),
+		MailLogFile:      getEnv("MAIL_LOG_FILE", ""),
+		SMTPHost:         getEnv("SMTP_HOST", ""),
+		SMTPPort:         getEnv("SMTP_PORT", "587"),
+		SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+		TrustedProxies:   getEnv("TRUSTED_PROXIES", "127.0.0.1,::1"),
+		LoginThrottle: LoginThrottleConfig{
+			FreeAttempts:     getEnvInt("LOGIN_FREE_ATTEMPTS", 3),
+			LockoutThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+			LockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute),
+			BackoffBase:      getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+			BackoffMax:       getEnvDuration("LOGIN_BACKOFF_MAX", 15*time.Minute),
+			FailureWindow:    getEnvDuration("LOGIN_FAILURE_WINDOW", 24*time.Hour),
+		},
+		EncryptionKeys:  getEnv("ENCRYPTION_KEYS", ""),
+		EncryptionKeyID: getEnv("ENCRYPTION_ACTIVE_KEY_ID", ""),
+		JWTSigningKeys:  getEnv("JWT_SIGNING_KEYS", ""),
+		JWTVerifyKeys:   getEnv("JWT_VERIFY_KEYS", ""),
+		JWTActiveKeyID:  getEnv("JWT_ACTIVE_KEY_ID", ""),
+
+		AccountDeletionGracePeriod: getEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour),
+		Jobs: JobQueueConfig{
+			Workers:      getEnvInt("JOB_WORKERS", 4),
+			PollInterval: getEnvDuration("JOB_POLL_INTERVAL", time.Second),
+			Lease:        getEnvDuration("JOB_LEASE", 15*time.Minute),
+			BackoffBase:  getEnvDuration("JOB_BACKOFF_BASE", 30*time.Second),
+			BackoffMax:   getEnvDuration("JOB_BACKOFF_MAX", time.Hour),
+		},
+		SyncSchedule: SyncScheduleConfig{
+			Interval:      getEnvDuration("SYNC_SCHEDULE_INTERVAL", 6*time.Hour),
+			Concurrency:   getEnvInt("SYNC_SCHEDULE_CONCURRENCY", 2),
+			RatePerMinute: getEnvInt("SYNC_SCHEDULE_RATE_PER_MINUTE", 30),
+		},
 	}
 
 	if cfg.DatabaseURL == "" {
@@ -38,13 +138,72 @@ func Load() Config {
 	if cfg.PlaidSecret == "" {
 		log.Fatal("PLAID_SECRET is required")
 	}
+	if cfg.EncryptionKeys == "" || cfg.EncryptionKeyID == "" {
+		log.Fatal("ENCRYPTION_KEYS and ENCRYPTION_ACTIVE_KEY_ID are required")
+	}
+	cfg.OIDCProviders = loadOIDCProviders(cfg.AppBaseURL)
+
+	if cfg.JWTSigningKeys == "" || cfg.JWTActiveKeyID == "" {
+		log.Fatal("JWT_SIGNING_KEYS and JWT_ACTIVE_KEY_ID are required")
+	}
 
 	return cfg
 }
 
+// loadOIDCProviders reads OIDC_PROVIDERS (for example "google,okta") and, for each name, the
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and _SCOPES variables.
+func loadOIDCProviders(appBaseURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", strings.TrimRight(appBaseURL, "/")+"/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Fatalf("%sISSUER and %sCLIENT_ID are required for OIDC provider %s", prefix, prefix, name)
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer: %v", key, err)
+	}
+	return n
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration such as 30s or 15m: %v", key, err)
+	}
+	return d
+}
@@ -6,8 +6,18 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Connect(url string) (*pgxpool.Pool, error) {
-	pool, err := pgxpool.New(context.Background(), url)
+// Connect opens the connection pool. maxConns must leave room for the job workers, the scheduled syncs and
+// the HTTP API at the same time; zero keeps pgxpool's default.
+func Connect(url string, maxConns int32) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		config.MaxConns = maxConns
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
 	}
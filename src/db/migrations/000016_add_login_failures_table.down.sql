@@ -0,0 +1,4 @@
+DROP TABLE login_failures;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS locked_until;
@@ -0,0 +1,16 @@
+ALTER TABLE users
+ADD COLUMN locked_until TIMESTAMP;
+
+-- Failed login counters, kept separately per account and per client IP
+CREATE TABLE login_failures (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    ip_address TEXT,
+    failure_count INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT login_failures_user_or_ip CHECK ((user_id IS NULL) <> (ip_address IS NULL))
+);
+
+CREATE UNIQUE INDEX login_failures_user_id_key ON login_failures (user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX login_failures_ip_address_key ON login_failures (ip_address) WHERE ip_address IS NOT NULL;
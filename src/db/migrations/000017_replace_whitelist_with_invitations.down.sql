@@ -0,0 +1,14 @@
+CREATE TABLE whitelisted_emails (
+    id SERIAL PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+INSERT INTO whitelisted_emails (email, created_at, updated_at)
+SELECT DISTINCT ON (LOWER(email)) email, created_at, updated_at
+FROM invitations
+WHERE email IS NOT NULL AND revoked_at IS NULL
+ORDER BY LOWER(email), created_at;
+
+DROP TABLE invitations;
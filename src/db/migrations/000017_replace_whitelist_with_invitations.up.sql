@@ -0,0 +1,26 @@
+-- Invitations replace the bare email whitelist. An invitation is either bound to a random code
+-- (new invitations) or only to an email address (rows migrated from whitelisted_emails).
+CREATE TABLE invitations (
+    id SERIAL PRIMARY KEY,
+    email TEXT,
+    code_hash TEXT UNIQUE,
+    role TEXT,
+    invited_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP,
+    redeemed_at TIMESTAMP,
+    redeemed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT invitations_email_or_code CHECK (email IS NOT NULL OR code_hash IS NOT NULL)
+);
+
+CREATE INDEX invitations_email_idx ON invitations (LOWER(email));
+
+-- Carry over existing whitelist entries. Entries whose email already belongs to a user are marked as used.
+INSERT INTO invitations (email, redeemed_at, redeemed_by, created_at, updated_at)
+SELECT LOWER(TRIM(w.email)), u.created_at, u.id, w.created_at, w.updated_at
+FROM whitelisted_emails w
+LEFT JOIN users u ON LOWER(u.email) = LOWER(TRIM(w.email));
+
+DROP TABLE whitelisted_emails;
@@ -0,0 +1,53 @@
+-- Roles group admin permissions. users.super_admin keeps working and is treated as holding every permission.
+CREATE TABLE roles (
+    id SERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE role_permissions (
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE user_roles (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    granted_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('support', 'View users, login failures and linked items'),
+    ('operator', 'Support access plus triggering syncs and clearing caches'),
+    ('admin', 'Full administrative access including role assignment');
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (VALUES
+    ('support', 'users:read'),
+    ('support', 'items:read'),
+    ('operator', 'users:read'),
+    ('operator', 'items:read'),
+    ('operator', 'sync:trigger'),
+    ('operator', 'cache:clear'),
+    ('admin', 'users:read'),
+    ('admin', 'users:write'),
+    ('admin', 'users:delete'),
+    ('admin', 'items:read'),
+    ('admin', 'items:write'),
+    ('admin', 'items:delete'),
+    ('admin', 'sync:trigger'),
+    ('admin', 'cache:clear'),
+    ('admin', 'invitations:manage'),
+    ('admin', 'roles:manage')
+) AS p(role_name, permission) ON p.role_name = r.name;
+
+-- Existing super admins get the admin role so they show up in role listings
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u, roles r
+WHERE u.super_admin = TRUE AND r.name = 'admin';
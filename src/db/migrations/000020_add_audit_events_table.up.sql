@@ -0,0 +1,37 @@
+-- Append-only record of administrative actions. Actor details are copied rather than referenced
+-- so events survive the actor being deleted.
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_user_id INTEGER,
+    actor_username TEXT,
+    action TEXT NOT NULL,
+    target_type TEXT,
+    target_id TEXT,
+    before JSONB,
+    after JSONB,
+    status_code INTEGER NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at DESC);
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_user_id, created_at DESC);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id, created_at DESC);
+
+CREATE FUNCTION audit_events_reject_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_or_delete
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_reject_change();
+
+CREATE TRIGGER audit_events_no_truncate
+BEFORE TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_reject_change();
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'audit:read' FROM roles WHERE name = 'admin';
@@ -0,0 +1,17 @@
+-- Every login attempt, successful or not. user_id is NULL when the username or email did not match an account.
+CREATE TABLE login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    identifier TEXT,
+    success BOOLEAN NOT NULL,
+    failure_reason TEXT,
+    ip_address TEXT,
+    ip_range TEXT,
+    user_agent TEXT,
+    device_fingerprint TEXT,
+    new_device BOOLEAN NOT NULL DEFAULT FALSE,
+    new_ip_range BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX login_events_user_id_idx ON login_events (user_id, created_at DESC);
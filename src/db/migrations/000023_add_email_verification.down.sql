@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS pending_email_requested_at,
+    DROP COLUMN IF EXISTS pending_email,
+    DROP COLUMN IF EXISTS email_verified_at;
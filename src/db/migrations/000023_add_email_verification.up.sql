@@ -0,0 +1,7 @@
+-- Accounts that existed before verification was introduced keep full access
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP,
+    ADD COLUMN pending_email TEXT,
+    ADD COLUMN pending_email_requested_at TIMESTAMP;
+
+UPDATE users SET email_verified_at = created_at;
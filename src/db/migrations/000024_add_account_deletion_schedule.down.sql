@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS users_deletion_scheduled_for_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deletion_scheduled_for,
+    DROP COLUMN IF EXISTS deletion_requested_at;
@@ -0,0 +1,6 @@
+-- Accounts whose owner asked for deletion are purged once deletion_scheduled_for passes
+ALTER TABLE users
+    ADD COLUMN deletion_requested_at TIMESTAMP,
+    ADD COLUMN deletion_scheduled_for TIMESTAMP;
+
+CREATE INDEX users_deletion_scheduled_for_idx ON users (deletion_scheduled_for) WHERE deletion_scheduled_for IS NOT NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE plaid_items
+    DROP COLUMN IF EXISTS status_updated_at,
+    DROP COLUMN IF EXISTS webhook_url,
+    DROP COLUMN IF EXISTS new_accounts_available,
+    DROP COLUMN IF EXISTS consent_expiration_time,
+    DROP COLUMN IF EXISTS error_message,
+    DROP COLUMN IF EXISTS error_code;
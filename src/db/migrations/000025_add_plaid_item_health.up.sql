@@ -0,0 +1,9 @@
+-- Item health as reported by Plaid ITEM webhooks. status is one of active, error, pending_expiration,
+-- pending_disconnect or revoked.
+ALTER TABLE plaid_items
+    ADD COLUMN error_code TEXT,
+    ADD COLUMN error_message TEXT,
+    ADD COLUMN consent_expiration_time TIMESTAMP,
+    ADD COLUMN new_accounts_available BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN webhook_url TEXT,
+    ADD COLUMN status_updated_at TIMESTAMP;
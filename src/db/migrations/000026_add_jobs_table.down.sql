@@ -0,0 +1,3 @@
+DELETE FROM role_permissions WHERE permission = 'jobs:manage';
+
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,26 @@
+-- Durable background work. Jobs move queued -> running -> succeeded, go back to queued with a later run_at
+-- after a failure, and end up dead once max_attempts is used up. At most one job per (kind, dedup_key) can
+-- be queued at a time, so repeated webhooks for an item collapse into a single sync.
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    dedup_key TEXT,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_at TIMESTAMP,
+    locked_by TEXT,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX jobs_queued_dedup_idx ON jobs (kind, dedup_key) WHERE status = 'queued';
+CREATE INDEX jobs_claim_idx ON jobs (run_at) WHERE status IN ('queued', 'running');
+CREATE INDEX jobs_status_idx ON jobs (status, created_at DESC);
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'jobs:manage' FROM roles WHERE name IN ('operator', 'admin');
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS plaid_items_last_synced_at_idx;
+
+ALTER TABLE plaid_items DROP COLUMN IF EXISTS last_synced_at;
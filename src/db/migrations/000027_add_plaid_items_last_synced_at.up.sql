@@ -0,0 +1,3 @@
+ALTER TABLE plaid_items ADD COLUMN last_synced_at TIMESTAMP;
+
+CREATE INDEX plaid_items_last_synced_at_idx ON plaid_items (last_synced_at NULLS FIRST);
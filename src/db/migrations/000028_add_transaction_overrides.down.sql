@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS plaid_values;
+ALTER TABLE transactions DROP COLUMN IF EXISTS user_overridden_fields;
@@ -0,0 +1,4 @@
+-- Fields the user has edited, which Plaid syncs and transaction rules no longer overwrite
+ALTER TABLE transactions ADD COLUMN user_overridden_fields TEXT[] NOT NULL DEFAULT '{}';
+-- Latest Plaid value of each overridden field, restored when the override is reset
+ALTER TABLE transactions ADD COLUMN plaid_values JSONB NOT NULL DEFAULT '{}';
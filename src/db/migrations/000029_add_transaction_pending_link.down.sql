@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS transactions_pending_transaction_id_idx;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS pending_transaction;
+ALTER TABLE transactions DROP COLUMN IF EXISTS pending_transaction_id;
@@ -0,0 +1,5 @@
+-- Plaid id of the pending transaction a posted transaction replaced, and how that pending version looked
+ALTER TABLE transactions ADD COLUMN pending_transaction_id TEXT;
+ALTER TABLE transactions ADD COLUMN pending_transaction JSONB;
+
+CREATE INDEX transactions_pending_transaction_id_idx ON transactions (pending_transaction_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS investment_transactions;
+DROP TABLE IF EXISTS holdings;
+DROP TABLE IF EXISTS securities;
@@ -0,0 +1,51 @@
+CREATE TABLE securities (
+    id SERIAL PRIMARY KEY,
+    security_id TEXT UNIQUE NOT NULL,
+    name TEXT,
+    ticker_symbol TEXT,
+    type TEXT,
+    subtype TEXT,
+    is_cash_equivalent BOOLEAN NOT NULL DEFAULT FALSE,
+    close_price numeric(28,10),
+    close_price_as_of DATE,
+    currency TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+-- One row per account, security and day, so the portfolio can be charted over time
+CREATE TABLE holdings (
+    id SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    security_id INTEGER NOT NULL REFERENCES securities(id),
+    snapshot_date DATE NOT NULL,
+    quantity numeric(28,10) NOT NULL,
+    institution_price numeric(28,10) NOT NULL,
+    institution_value numeric(28,10) NOT NULL,
+    cost_basis numeric(28,10),
+    currency TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (account_id, security_id, snapshot_date)
+);
+
+CREATE INDEX holdings_account_snapshot_idx ON holdings (account_id, snapshot_date DESC);
+
+CREATE TABLE investment_transactions (
+    id SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    investment_transaction_id TEXT UNIQUE NOT NULL,
+    security_id INTEGER REFERENCES securities(id),
+    date DATE NOT NULL,
+    name TEXT NOT NULL,
+    quantity numeric(28,10) NOT NULL,
+    amount numeric(28,10) NOT NULL,
+    price numeric(28,10) NOT NULL,
+    fees numeric(28,10),
+    type TEXT NOT NULL,
+    subtype TEXT NOT NULL,
+    currency TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX investment_transactions_account_date_idx ON investment_transactions (account_id, date DESC);
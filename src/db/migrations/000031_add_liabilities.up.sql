@@ -0,0 +1,25 @@
+CREATE TABLE liabilities (
+    id SERIAL PRIMARY KEY,
+    account_id INTEGER UNIQUE NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    type TEXT NOT NULL,
+    interest_rate_percentage numeric(10,4),
+    interest_rate_type TEXT,
+    minimum_payment_amount numeric(28,10),
+    next_payment_due_date DATE,
+    last_payment_amount numeric(28,10),
+    last_payment_date DATE,
+    last_statement_balance numeric(28,10),
+    last_statement_issue_date DATE,
+    is_overdue BOOLEAN,
+    origination_date DATE,
+    origination_principal_amount numeric(28,10),
+    -- Maturity date of a mortgage, expected payoff date of a student loan
+    payoff_date DATE,
+    loan_term TEXT,
+    loan_name TEXT,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX liabilities_next_payment_due_date_idx ON liabilities (next_payment_due_date);
@@ -0,0 +1,28 @@
+CREATE TABLE recurring_streams (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    -- detected from the user's history or reported by Plaid's recurring transactions
+    source TEXT NOT NULL,
+    plaid_stream_id TEXT,
+    merchant_key TEXT NOT NULL,
+    merchant_name TEXT NOT NULL,
+    category TEXT,
+    direction TEXT NOT NULL,
+    frequency TEXT NOT NULL,
+    average_amount numeric(28,10) NOT NULL,
+    last_amount numeric(28,10) NOT NULL,
+    -- Amount before the most recent price change of a fixed-amount stream
+    previous_amount numeric(28,10),
+    price_changed_on DATE,
+    first_date DATE NOT NULL,
+    last_date DATE NOT NULL,
+    next_expected_date DATE,
+    transaction_count INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX recurring_streams_user_id_next_expected_date_idx ON recurring_streams (user_id, next_expected_date);
+CREATE UNIQUE INDEX recurring_streams_plaid_stream_id_idx ON recurring_streams (plaid_stream_id) WHERE plaid_stream_id IS NOT NULL;
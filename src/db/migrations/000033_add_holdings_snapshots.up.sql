@@ -0,0 +1,11 @@
+-- One row per investment account and day a holdings snapshot was taken, including days the account held
+-- nothing, so a sold-out account's newest snapshot is the empty one rather than its last day with holdings
+CREATE TABLE holdings_snapshots (
+    account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    snapshot_date DATE NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW(),
+    PRIMARY KEY (account_id, snapshot_date)
+);
+
+INSERT INTO holdings_snapshots (account_id, snapshot_date)
+SELECT DISTINCT account_id, snapshot_date FROM holdings;
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoDeletionScheduled = errors.New("no account deletion is scheduled")
+
+// Advisory lock namespace for the scheduled account purge, which runs as a single lock with key 0
+const accountDeletionLockClass int32 = 2
+
+// ScheduleUserDeletion marks the account for purging at scheduledFor. Asking again keeps the original date.
+func ScheduleUserDeletion(ctx context.Context, pool *pgxpool.Pool, userID int64, scheduledFor time.Time) (time.Time, error) {
+	query := `
+		UPDATE users
+		SET deletion_requested_at = COALESCE(deletion_requested_at, NOW()),
+			deletion_scheduled_for = COALESCE(deletion_scheduled_for, $1),
+			updated_at = NOW()
+		WHERE id = $2
+		RETURNING deletion_scheduled_for
+	`
+	var scheduled time.Time
+	err := pool.QueryRow(ctx, query, scheduledFor, userID).Scan(&scheduled)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule user deletion: %w", err)
+	}
+	return scheduled, nil
+}
+
+func CancelUserDeletion(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	query := `
+		UPDATE users
+		SET deletion_requested_at = NULL, deletion_scheduled_for = NULL, updated_at = NOW()
+		WHERE id = $1 AND deletion_scheduled_for IS NOT NULL
+	`
+	cmd, err := pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel user deletion: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrNoDeletionScheduled
+	}
+	return nil
+}
+
+// GetUsersDueForDeletion returns the users whose grace period has run out.
+func GetUsersDueForDeletion(ctx context.Context, pool *pgxpool.Pool) ([]int64, error) {
+	query := `SELECT id FROM users WHERE deletion_scheduled_for <= NOW() ORDER BY deletion_scheduled_for`
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users due for deletion: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user id: %w", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+// TryLockAccountDeletions takes a session advisory lock that lets only one instance purge accounts at a time. The
+// lock is held on a dedicated connection until release is called.
+func TryLockAccountDeletions(ctx context.Context, pool *pgxpool.Pool) (release func(), acquired bool, err error) {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to acquire connection for account deletion lock: %w", err)
+	}
+
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1, 0)`, accountDeletionLockClass).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("failed to take account deletion lock: %w", err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	release = func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1, 0)`, accountDeletionLockClass); err != nil {
+			// Closing the connection drops any session lock it still holds
+			conn.Conn().Close(context.Background())
+		}
+		conn.Release()
+	}
+	return release, true, nil
+}
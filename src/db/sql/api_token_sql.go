@@ -0,0 +1,90 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvalidAPIToken = errors.New("api token is invalid, expired or revoked")
+
+const apiTokenColumns = `id, user_id, name, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at`
+
+func scanAPIToken(row pgx.Row) (*models.APIToken, error) {
+	var t models.APIToken
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.LastUsedIP, &t.RevokedAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func CreateAPIToken(ctx context.Context, pool *pgxpool.Pool, userID int64, name, tokenHash string, scopes []string, expiresAt time.Time) (*models.APIToken, error) {
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + apiTokenColumns
+	t, err := scanAPIToken(pool.QueryRow(ctx, query, userID, name, tokenHash, scopes, expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api token: %w", err)
+	}
+	return t, nil
+}
+
+func GetAPITokensForUser(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// AuthenticateAPIToken looks up a live token by hash and records its use. Last-used tracking is only
+// written once a minute per token so scripts hammering the API do not turn every request into a write.
+func AuthenticateAPIToken(ctx context.Context, pool *pgxpool.Pool, tokenHash, ip string) (*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = $1 AND revoked_at IS NULL AND expires_at > NOW()`
+	t, err := scanAPIToken(pool.QueryRow(ctx, query, tokenHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidAPIToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api token: %w", err)
+	}
+
+	_, err = pool.Exec(ctx, `
+		UPDATE api_tokens SET last_used_at = NOW(), last_used_ip = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, t.ID, ip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update api token usage: %w", err)
+	}
+	return t, nil
+}
+
+func RevokeAPIToken(ctx context.Context, pool *pgxpool.Pool, id, userID int64) error {
+	query := `UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	cmd, err := pool.Exec(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("api token not found")
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func InsertAuditEvent(ctx context.Context, pool *pgxpool.Pool, event models.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_user_id, actor_username, action, target_type, target_id, before, after, status_code, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := pool.Exec(ctx, query,
+		event.ActorUserID,
+		event.ActorUsername,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		nullableJSON(event.Before),
+		nullableJSON(event.After),
+		event.StatusCode,
+		event.IPAddress,
+		event.UserAgent,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEvents returns one page of audit events matching the filter, newest first, along with the total match count.
+func GetAuditEvents(ctx context.Context, pool *pgxpool.Pool, filter models.AuditEventFilter) ([]models.AuditEvent, int64, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, strings.Replace(clause, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if filter.ActorUserID != 0 {
+		addCondition("actor_user_id = ?", filter.ActorUserID)
+	}
+	if filter.Action != "" {
+		addCondition("action ILIKE ?", "%"+filter.Action+"%")
+	}
+	if filter.TargetType != "" {
+		addCondition("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		addCondition("target_id = ?", filter.TargetID)
+	}
+	if filter.From != nil {
+		addCondition("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("created_at < ?", *filter.To)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := `
+		SELECT id, actor_user_id, actor_username, action, target_type, target_id, before, after, status_code, ip_address, user_agent, created_at
+		FROM audit_events` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		var before, after []byte
+		err := rows.Scan(&e.ID, &e.ActorUserID, &e.ActorUsername, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.StatusCode, &e.IPAddress, &e.UserAgent, &e.CreatedAt)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		e.Before = before
+		e.After = after
+		events = append(events, e)
+	}
+	return events, total, rows.Err()
+}
+
+// nullableJSON stores an empty payload as SQL NULL rather than an invalid empty JSON document.
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrEmailVerificationStale = errors.New("email verification link no longer matches the account")
+	ErrEmailInUse             = errors.New("email is already in use")
+)
+
+// MarkEmailVerified confirms the user's current email. It fails with ErrEmailVerificationStale when the
+// email has changed since the link was sent.
+func MarkEmailVerified(ctx context.Context, pool *pgxpool.Pool, userID int64, email string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1 AND email = $2
+	`
+	cmd, err := pool.Exec(ctx, query, userID, email)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrEmailVerificationStale
+	}
+	return nil
+}
+
+// SetPendingEmail records an email change that takes effect once the new address is confirmed.
+func SetPendingEmail(ctx context.Context, pool *pgxpool.Pool, userID int64, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1, pending_email_requested_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+	`
+	_, err := pool.Exec(ctx, query, email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+	return nil
+}
+
+// CancelPendingEmail drops an unconfirmed email change.
+func CancelPendingEmail(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	query := `
+		UPDATE users
+		SET pending_email = NULL, pending_email_requested_at = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel pending email: %w", err)
+	}
+	return nil
+}
+
+// ConfirmPendingEmail swaps in the pending email, which counts as verified by the confirmation itself.
+// Only the most recently requested address can be confirmed.
+func ConfirmPendingEmail(ctx context.Context, pool *pgxpool.Pool, userID int64, email string) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, pending_email_requested_at = NULL,
+			email_verified_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND pending_email = $2
+	`
+	cmd, err := pool.Exec(ctx, query, userID, email)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key") {
+			return ErrEmailInUse
+		}
+		return fmt.Errorf("failed to confirm pending email: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrEmailVerificationStale
+	}
+	return nil
+}
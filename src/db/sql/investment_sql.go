@@ -0,0 +1,423 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// latestHoldingsCTE selects, for each of user $1's investment accounts, the date of its newest holdings snapshot.
+// The dates come from holdings_snapshots, so an account whose newest snapshot was empty has no holdings.
+const latestHoldingsCTE = `
+	WITH latest AS (
+		SELECT s.account_id, MAX(s.snapshot_date) AS snapshot_date
+		FROM holdings_snapshots s
+		JOIN accounts a ON s.account_id = a.id
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.user_id = $1
+		GROUP BY s.account_id
+	)
+`
+
+// SaveHoldingsSnapshot stores today's holdings for the item's accounts, replacing any snapshot already taken
+// today so positions that were sold since do not linger. The snapshot is recorded for every investment account
+// of the item, including those Plaid returned no holdings for, so an account that was sold out reads as empty
+// rather than as its last day with holdings. It returns the number of holdings saved.
+func SaveHoldingsSnapshot(ctx context.Context, pool *pgxpool.Pool, itemID string, securities []plaid.Security, holdings []plaid.Holding) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	securityIDs, err := upsertSecurities(ctx, tx, securities)
+	if err != nil {
+		return 0, err
+	}
+	accountIDs, err := getItemAccountIDs(ctx, tx, itemID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM holdings
+		WHERE snapshot_date = CURRENT_DATE AND account_id IN (
+			SELECT a.id FROM accounts a
+			JOIN plaid_items p ON a.item_id = p.id
+			WHERE p.item_id = $1
+		)
+	`, itemID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear today's holdings: %w", err)
+	}
+
+	query := `
+		INSERT INTO holdings (account_id, security_id, snapshot_date, quantity, institution_price, institution_value, cost_basis, currency)
+		VALUES ($1, $2, CURRENT_DATE, $3, $4, $5, $6, $7)
+	`
+	batch := &pgx.Batch{}
+	saved := 0
+	for _, holding := range holdings {
+		accountID, ok := accountIDs[holding.GetAccountId()]
+		if !ok {
+			// The account was not shared with us or has not been saved yet
+			continue
+		}
+		securityID, ok := securityIDs[holding.GetSecurityId()]
+		if !ok {
+			return 0, fmt.Errorf("holding references unknown security %s", holding.GetSecurityId())
+		}
+		batch.Queue(query,
+			accountID,
+			securityID,
+			holding.GetQuantity(),
+			holding.GetInstitutionPrice(),
+			holding.GetInstitutionValue(),
+			holding.CostBasis.Get(),
+			holding.IsoCurrencyCode.Get(),
+		)
+		saved++
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("failed to save holdings: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO holdings_snapshots (account_id, snapshot_date)
+		SELECT a.id, CURRENT_DATE
+		FROM accounts a
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.item_id = $1 AND (a.type = 'investment' OR a.id IN (
+			SELECT account_id FROM holdings WHERE snapshot_date = CURRENT_DATE
+		))
+		ON CONFLICT (account_id, snapshot_date) DO NOTHING
+	`, itemID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record holdings snapshot: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return saved, nil
+}
+
+// SaveInvestmentTransactions upserts the item's investment transactions. Transactions that cancel an earlier
+// one remove it. It returns the number of transactions saved.
+func SaveInvestmentTransactions(ctx context.Context, pool *pgxpool.Pool, itemID string, securities []plaid.Security, transactions []plaid.InvestmentTransaction) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	securityIDs, err := upsertSecurities(ctx, tx, securities)
+	if err != nil {
+		return 0, err
+	}
+	accountIDs, err := getItemAccountIDs(ctx, tx, itemID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO investment_transactions (account_id, investment_transaction_id, security_id, date, name, quantity, amount, price, fees, type, subtype, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (investment_transaction_id) DO UPDATE
+		SET security_id = EXCLUDED.security_id, date = EXCLUDED.date, name = EXCLUDED.name, quantity = EXCLUDED.quantity,
+			amount = EXCLUDED.amount, price = EXCLUDED.price, fees = EXCLUDED.fees, type = EXCLUDED.type,
+			subtype = EXCLUDED.subtype, currency = EXCLUDED.currency, updated_at = NOW()
+	`
+	batch := &pgx.Batch{}
+	saved := 0
+	for _, txn := range transactions {
+		accountID, ok := accountIDs[txn.GetAccountId()]
+		if !ok {
+			continue
+		}
+
+		var securityID *int
+		if plaidSecurityID := txn.SecurityId.Get(); plaidSecurityID != nil {
+			id, ok := securityIDs[*plaidSecurityID]
+			if !ok {
+				return 0, fmt.Errorf("investment transaction references unknown security %s", *plaidSecurityID)
+			}
+			securityID = &id
+		}
+
+		batch.Queue(query,
+			accountID,
+			txn.GetInvestmentTransactionId(),
+			securityID,
+			txn.GetDate(),
+			txn.GetName(),
+			txn.GetQuantity(),
+			txn.GetAmount(),
+			txn.GetPrice(),
+			txn.Fees.Get(),
+			string(txn.GetType()),
+			string(txn.GetSubtype()),
+			txn.IsoCurrencyCode.Get(),
+		)
+		saved++
+		if cancelled := txn.GetCancelTransactionId(); cancelled != "" {
+			batch.Queue(`DELETE FROM investment_transactions WHERE investment_transaction_id = $1 AND account_id = $2`, cancelled, accountID)
+		}
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("failed to save investment transactions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return saved, nil
+}
+
+// GetLatestInvestmentTransactionDate returns the date of the item's newest investment transaction, or nil
+// when none have been synced yet.
+func GetLatestInvestmentTransactionDate(ctx context.Context, pool *pgxpool.Pool, itemID string) (*time.Time, error) {
+	query := `
+		SELECT MAX(t.date)
+		FROM investment_transactions t
+		JOIN accounts a ON t.account_id = a.id
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.item_id = $1
+	`
+	var latest *time.Time
+	if err := pool.QueryRow(ctx, query, itemID).Scan(&latest); err != nil {
+		return nil, fmt.Errorf("failed to get latest investment transaction date: %w", err)
+	}
+	return latest, nil
+}
+
+// upsertSecurities saves Plaid's view of the securities and returns their ids keyed by Plaid security id.
+func upsertSecurities(ctx context.Context, tx pgx.Tx, securities []plaid.Security) (map[string]int, error) {
+	query := `
+		INSERT INTO securities (security_id, name, ticker_symbol, type, subtype, is_cash_equivalent, close_price, close_price_as_of, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (security_id) DO UPDATE
+		SET name = EXCLUDED.name, ticker_symbol = EXCLUDED.ticker_symbol, type = EXCLUDED.type, subtype = EXCLUDED.subtype,
+			is_cash_equivalent = EXCLUDED.is_cash_equivalent, close_price = EXCLUDED.close_price,
+			close_price_as_of = EXCLUDED.close_price_as_of, currency = EXCLUDED.currency, updated_at = NOW()
+		RETURNING id
+	`
+	batch := &pgx.Batch{}
+	for _, security := range securities {
+		batch.Queue(query,
+			security.GetSecurityId(),
+			security.Name.Get(),
+			security.TickerSymbol.Get(),
+			security.Type.Get(),
+			security.Subtype.Get(),
+			security.GetIsCashEquivalent(),
+			security.ClosePrice.Get(),
+			security.ClosePriceAsOf.Get(),
+			security.IsoCurrencyCode.Get(),
+		)
+	}
+
+	results := tx.SendBatch(ctx, batch)
+	ids := make(map[string]int, len(securities))
+	for _, security := range securities {
+		var id int
+		if err := results.QueryRow().Scan(&id); err != nil {
+			results.Close()
+			return nil, fmt.Errorf("failed to save security %s: %w", security.GetSecurityId(), err)
+		}
+		ids[security.GetSecurityId()] = id
+	}
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("failed to save securities: %w", err)
+	}
+	return ids, nil
+}
+
+// getItemAccountIDs returns the ids of the item's accounts keyed by Plaid account id.
+func getItemAccountIDs(ctx context.Context, tx pgx.Tx, itemID string) (map[string]int, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT a.account_id, a.id
+		FROM accounts a
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.item_id = $1
+	`, itemID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query item accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accountIDs := make(map[string]int)
+	for rows.Next() {
+		var plaidAccountID string
+		var id int
+		if err := rows.Scan(&plaidAccountID, &id); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accountIDs[plaidAccountID] = id
+	}
+	return accountIDs, rows.Err()
+}
+
+// GetLatestHoldings returns the holdings in each of the user's accounts as of that account's newest snapshot.
+func GetLatestHoldings(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.Holding, error) {
+	query := latestHoldingsCTE + `
+		SELECT h.id, h.account_id, h.security_id, h.snapshot_date, h.quantity, h.institution_price, h.institution_value,
+			h.cost_basis, h.currency, h.created_at, s.name, s.ticker_symbol, s.type
+		FROM holdings h
+		JOIN latest l ON h.account_id = l.account_id AND h.snapshot_date = l.snapshot_date
+		JOIN securities s ON h.security_id = s.id
+		ORDER BY h.account_id, h.institution_value DESC
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holdings: %w", err)
+	}
+	defer rows.Close()
+
+	holdings := []models.Holding{}
+	for rows.Next() {
+		var h models.Holding
+		err := rows.Scan(&h.ID, &h.AccountID, &h.SecurityID, &h.SnapshotDate, &h.Quantity, &h.InstitutionPrice, &h.InstitutionValue,
+			&h.CostBasis, &h.Currency, &h.CreatedAt, &h.SecurityName, &h.TickerSymbol, &h.SecurityType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan holding: %w", err)
+		}
+		holdings = append(holdings, h)
+	}
+	return holdings, rows.Err()
+}
+
+// GetInvestmentTransactions returns the user's investment transactions, newest first, optionally limited to
+// one account.
+func GetInvestmentTransactions(ctx context.Context, pool *pgxpool.Pool, userID int64, accountID *int) ([]models.InvestmentTransaction, error) {
+	query := `
+		SELECT t.id, t.account_id, t.investment_transaction_id, t.security_id, t.date, t.name, t.quantity, t.amount, t.price,
+			t.fees, t.type, t.subtype, t.currency, t.created_at, t.updated_at
+		FROM investment_transactions t
+		JOIN accounts a ON t.account_id = a.id
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.user_id = $1 AND ($2::int IS NULL OR t.account_id = $2)
+		ORDER BY t.date DESC, t.id DESC
+	`
+	rows, err := pool.Query(ctx, query, userID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query investment transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := []models.InvestmentTransaction{}
+	for rows.Next() {
+		var t models.InvestmentTransaction
+		err := rows.Scan(&t.ID, &t.AccountID, &t.InvestmentTransactionID, &t.SecurityID, &t.Date, &t.Name, &t.Quantity, &t.Amount,
+			&t.Price, &t.Fees, &t.Type, &t.Subtype, &t.Currency, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan investment transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// GetPortfolioValue returns the value of each of the user's investment accounts from its newest snapshot. An
+// account whose newest snapshot was empty is worth 0.
+func GetPortfolioValue(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.AccountPortfolioValue, error) {
+	query := latestHoldingsCTE + `
+		SELECT a.id, a.name, l.snapshot_date, COALESCE(SUM(h.institution_value), 0)
+		FROM latest l
+		JOIN accounts a ON l.account_id = a.id
+		LEFT JOIN holdings h ON h.account_id = l.account_id AND h.snapshot_date = l.snapshot_date
+		GROUP BY a.id, a.name, l.snapshot_date
+		ORDER BY a.name
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query portfolio value: %w", err)
+	}
+	defer rows.Close()
+
+	values := []models.AccountPortfolioValue{}
+	for rows.Next() {
+		var v models.AccountPortfolioValue
+		if err := rows.Scan(&v.AccountID, &v.AccountName, &v.SnapshotDate, &v.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan portfolio value: %w", err)
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// GetAllocationBySecurityType returns how the user's latest holdings are split across security types.
+func GetAllocationBySecurityType(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.AllocationSlice, error) {
+	query := latestHoldingsCTE + `
+		SELECT COALESCE(s.type, 'unknown'), SUM(h.institution_value)
+		FROM holdings h
+		JOIN latest l ON h.account_id = l.account_id AND h.snapshot_date = l.snapshot_date
+		JOIN securities s ON h.security_id = s.id
+		GROUP BY 1
+		ORDER BY 2 DESC
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query allocation: %w", err)
+	}
+	defer rows.Close()
+
+	allocation := []models.AllocationSlice{}
+	total := 0.0
+	for rows.Next() {
+		var slice models.AllocationSlice
+		if err := rows.Scan(&slice.SecurityType, &slice.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan allocation: %w", err)
+		}
+		total += slice.Value
+		allocation = append(allocation, slice)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if total != 0 {
+		for i := range allocation {
+			allocation[i].Percentage = allocation[i].Value / total * 100
+		}
+	}
+	return allocation, nil
+}
+
+// GetCostBasisByAccount returns the cost basis and unrealized gain of each of the user's investment accounts.
+func GetCostBasisByAccount(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.AccountCostBasis, error) {
+	query := latestHoldingsCTE + `
+		SELECT a.id, a.name,
+			COALESCE(SUM(h.cost_basis), 0),
+			COALESCE(SUM(h.institution_value) FILTER (WHERE h.cost_basis IS NOT NULL), 0),
+			COALESCE(SUM(h.institution_value) FILTER (WHERE h.cost_basis IS NULL), 0)
+		FROM latest l
+		JOIN accounts a ON l.account_id = a.id
+		JOIN holdings h ON h.account_id = l.account_id AND h.snapshot_date = l.snapshot_date
+		GROUP BY a.id, a.name
+		ORDER BY a.name
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cost basis: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.AccountCostBasis{}
+	for rows.Next() {
+		var c models.AccountCostBasis
+		if err := rows.Scan(&c.AccountID, &c.AccountName, &c.CostBasis, &c.Value, &c.UnknownCostBasisValue); err != nil {
+			return nil, fmt.Errorf("failed to scan cost basis: %w", err)
+		}
+		c.Gain = c.Value - c.CostBasis
+		// Value reported to the client covers every holding, the gain only those with a known cost basis
+		c.Value += c.UnknownCostBasisValue
+		accounts = append(accounts, c)
+	}
+	return accounts, rows.Err()
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+func TestSoldOutAccountHasNoLatestHoldings(t *testing.T) {
+	f := newTestFixture(t, "investment", "brokerage")
+	ctx := context.Background()
+
+	security := plaid.Security{}
+	security.SetSecurityId(f.accountID + "-security")
+	security.SetName("Index Fund")
+	security.SetType("mutual fund")
+	t.Cleanup(func() {
+		f.pool.Exec(context.Background(), `DELETE FROM securities WHERE security_id = $1`, security.GetSecurityId())
+	})
+	// Runs first, the holdings reference the security
+	t.Cleanup(func() {
+		f.pool.Exec(context.Background(), `
+			DELETE FROM holdings WHERE account_id = (SELECT id FROM accounts WHERE account_id = $1)
+		`, f.accountID)
+	})
+
+	holding := plaid.Holding{}
+	holding.SetAccountId(f.accountID)
+	holding.SetSecurityId(security.GetSecurityId())
+	holding.SetQuantity(10)
+	holding.SetInstitutionPrice(100)
+	holding.SetInstitutionValue(1000)
+
+	if _, err := SaveHoldingsSnapshot(ctx, f.pool, f.itemID, []plaid.Security{security}, []plaid.Holding{holding}); err != nil {
+		t.Fatalf("failed to save holdings: %v", err)
+	}
+	// Age the snapshot so the next one is taken on a later day
+	_, err := f.pool.Exec(ctx, `
+		WITH account AS (SELECT id FROM accounts WHERE account_id = $1),
+		moved AS (
+			UPDATE holdings_snapshots SET snapshot_date = snapshot_date - 1 WHERE account_id = (SELECT id FROM account)
+		)
+		UPDATE holdings SET snapshot_date = snapshot_date - 1 WHERE account_id = (SELECT id FROM account)
+	`, f.accountID)
+	if err != nil {
+		t.Fatalf("failed to age snapshot: %v", err)
+	}
+
+	// Everything was sold, Plaid returns the account without holdings
+	if _, err := SaveHoldingsSnapshot(ctx, f.pool, f.itemID, nil, nil); err != nil {
+		t.Fatalf("failed to save empty holdings: %v", err)
+	}
+
+	holdings, err := GetLatestHoldings(ctx, f.pool, f.userID)
+	if err != nil {
+		t.Fatalf("GetLatestHoldings failed: %v", err)
+	}
+	if len(holdings) != 0 {
+		t.Fatalf("sold-out account still has %d holdings", len(holdings))
+	}
+
+	values, err := GetPortfolioValue(ctx, f.pool, f.userID)
+	if err != nil {
+		t.Fatalf("GetPortfolioValue failed: %v", err)
+	}
+	if len(values) != 1 || values[0].Value != 0 {
+		t.Fatalf("portfolio value = %+v, want one account worth 0", values)
+	}
+
+	allocation, err := GetAllocationBySecurityType(ctx, f.pool, f.userID)
+	if err != nil {
+		t.Fatalf("GetAllocationBySecurityType failed: %v", err)
+	}
+	if len(allocation) != 0 {
+		t.Fatalf("allocation = %+v, want none", allocation)
+	}
+
+	costBasis, err := GetCostBasisByAccount(ctx, f.pool, f.userID)
+	if err != nil {
+		t.Fatalf("GetCostBasisByAccount failed: %v", err)
+	}
+	if len(costBasis) != 0 {
+		t.Fatalf("cost basis = %+v, want none", costBasis)
+	}
+}
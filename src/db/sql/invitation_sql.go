@@ -0,0 +1,180 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvitationInvalid = errors.New("invitation is invalid, expired or already used")
+
+const invitationColumns = `
+	id, email, role, invited_by, expires_at, redeemed_at, redeemed_by, revoked_at,
+	CASE
+		WHEN revoked_at IS NOT NULL THEN 'revoked'
+		WHEN redeemed_at IS NOT NULL THEN 'used'
+		WHEN expires_at IS NOT NULL AND expires_at < NOW() THEN 'expired'
+		ELSE 'pending'
+	END AS status,
+	created_at, updated_at
+`
+
+func scanInvitation(row pgx.Row) (*models.Invitation, error) {
+	var inv models.Invitation
+	err := row.Scan(&inv.ID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.RedeemedAt, &inv.RedeemedBy, &inv.RevokedAt, &inv.Status, &inv.CreatedAt, &inv.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func CreateInvitation(ctx context.Context, pool *pgxpool.Pool, email *string, codeHash string, role *string, invitedBy int64, expiresAt time.Time) (*models.Invitation, error) {
+	query := `
+		INSERT INTO invitations (email, code_hash, role, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + invitationColumns
+	inv, err := scanInvitation(pool.QueryRow(ctx, query, email, codeHash, role, invitedBy, expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// GetInvitations lists invitations, optionally filtered by status (pending, used, expired or revoked).
+func GetInvitations(ctx context.Context, pool *pgxpool.Pool, status string) ([]models.Invitation, error) {
+	query := `
+		SELECT * FROM (
+			SELECT ` + invitationColumns + ` FROM invitations
+		) i
+		WHERE $1 = '' OR i.status = $1
+		ORDER BY i.created_at DESC
+	`
+	rows, err := pool.Query(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []models.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, *inv)
+	}
+	return invitations, rows.Err()
+}
+
+// RevokeInvitation revokes an invitation that has not been used yet.
+func RevokeInvitation(ctx context.Context, pool *pgxpool.Pool, id int64) error {
+	query := `
+		UPDATE invitations
+		SET revoked_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND redeemed_at IS NULL AND revoked_at IS NULL
+	`
+	cmd, err := pool.Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("invitation not found or already used")
+	}
+	return nil
+}
+
+// RegisterWithInvitation creates the user and redeems the invitation in a single transaction, so an
+// invitation can never be used twice. With a code the matching invitation is used (and its email, if any,
+// must match); without one, only a legacy email-only invitation for the same email is accepted.
+func RegisterWithInvitation(ctx context.Context, pool *pgxpool.Pool, req models.RegisterRequest, hashedPassword string, codeHash string) (*models.RegisterResponse, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin registration transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		invitationID int64
+		email        *string
+		role         *string
+		expiresAt    *time.Time
+		redeemedAt   *time.Time
+		revokedAt    *time.Time
+	)
+	if codeHash != "" {
+		query := `SELECT id, email, role, expires_at, redeemed_at, revoked_at FROM invitations WHERE code_hash = $1 FOR UPDATE`
+		err = tx.QueryRow(ctx, query, codeHash).Scan(&invitationID, &email, &role, &expiresAt, &redeemedAt, &revokedAt)
+	} else {
+		query := `
+			SELECT id, email, role, expires_at, redeemed_at, revoked_at FROM invitations
+			WHERE code_hash IS NULL AND LOWER(email) = LOWER($1)
+				AND redeemed_at IS NULL AND revoked_at IS NULL
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE
+		`
+		err = tx.QueryRow(ctx, query, req.Email).Scan(&invitationID, &email, &role, &expiresAt, &redeemedAt, &revokedAt)
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvitationInvalid
+		}
+		return nil, fmt.Errorf("failed to look up invitation: %w", err)
+	}
+
+	if redeemedAt != nil || revokedAt != nil || (expiresAt != nil && time.Now().UTC().After(*expiresAt)) {
+		return nil, ErrInvitationInvalid
+	}
+	if email != nil && !strings.EqualFold(strings.TrimSpace(*email), req.Email) {
+		return nil, ErrInvitationInvalid
+	}
+
+	superAdmin := role != nil && *role == "super_admin"
+
+	query := `
+		INSERT INTO users (first_name, last_name, username, email, password_hash, last_login, super_admin)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, super_admin
+	`
+	var userID int
+	err = tx.QueryRow(ctx, query, req.FirstName, req.LastName, req.Username, req.Email, hashedPassword, time.Now().UTC(), superAdmin).Scan(&userID, &superAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	// Any other non-default role on the invitation names an admin role to grant
+	if role != nil && *role != "user" && *role != "super_admin" {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO user_roles (user_id, role_id)
+			SELECT $1, id FROM roles WHERE name = $2
+			ON CONFLICT DO NOTHING
+		`, userID, *role)
+		if err != nil {
+			return nil, fmt.Errorf("failed to assign invited role: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE invitations SET redeemed_at = NOW(), redeemed_by = $1, updated_at = NOW() WHERE id = $2`, userID, invitationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem invitation: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit registration: %w", err)
+	}
+
+	return &models.RegisterResponse{
+		ID:         userID,
+		Email:      req.Email,
+		Username:   req.Username,
+		FirstName:  req.FirstName,
+		LastName:   req.LastName,
+		SuperAdmin: superAdmin,
+	}, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"budgee-server/src/db"
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrPlaidItemNotFound = errors.New("plaid item not found")
+
+// updatePlaidItemByItemID applies set to the item with the given Plaid item_id and drops the cached item lists.
+// set may reference $2 onwards, $1 is the item_id.
+func updatePlaidItemByItemID(ctx context.Context, pool *pgxpool.Pool, itemID string, set string, args ...interface{}) error {
+	query := `UPDATE plaid_items SET ` + set + `, updated_at = NOW() WHERE item_id = $1 RETURNING user_id`
+
+	var userID int64
+	err := pool.QueryRow(ctx, query, append([]interface{}{itemID}, args...)...).Scan(&userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrPlaidItemNotFound
+		}
+		return fmt.Errorf("failed to update plaid item %s: %w", itemID, err)
+	}
+
+	db.DelItemCache("items_user_" + fmt.Sprint(userID))
+	db.DelItemCache("items_all")
+	return nil
+}
+
+// SetPlaidItemError records an error Plaid reported for the item, such as ITEM_LOGIN_REQUIRED.
+func SetPlaidItemError(ctx context.Context, pool *pgxpool.Pool, itemID, status, errorCode, errorMessage string) error {
+	return updatePlaidItemByItemID(ctx, pool, itemID,
+		`status = $2, error_code = NULLIF($3, ''), error_message = NULLIF($4, ''), status_updated_at = NOW()`,
+		status, errorCode, errorMessage)
+}
+
+// ClearPlaidItemError marks the item healthy again, for example after the user re-authenticated it.
+// Any consent expiry is dropped too, since re-authenticating renews consent.
+func ClearPlaidItemError(ctx context.Context, pool *pgxpool.Pool, itemID string) error {
+	return updatePlaidItemByItemID(ctx, pool, itemID,
+		`status = $2, error_code = NULL, error_message = NULL, consent_expiration_time = NULL, status_updated_at = NOW()`,
+		models.ItemStatusActive)
+}
+
+func SetPlaidItemConsentExpiration(ctx context.Context, pool *pgxpool.Pool, itemID string, expiresAt *time.Time) error {
+	return updatePlaidItemByItemID(ctx, pool, itemID,
+		`status = $2, consent_expiration_time = $3, status_updated_at = NOW()`,
+		models.ItemStatusPendingExpiration, expiresAt)
+}
+
+func SetPlaidItemNewAccountsAvailable(ctx context.Context, pool *pgxpool.Pool, itemID string, available bool) error {
+	return updatePlaidItemByItemID(ctx, pool, itemID, `new_accounts_available = $2`, available)
+}
+
+func SetPlaidItemWebhookURL(ctx context.Context, pool *pgxpool.Pool, itemID, webhookURL string) error {
+	return updatePlaidItemByItemID(ctx, pool, itemID, `webhook_url = $2`, webhookURL)
+}
@@ -0,0 +1,241 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobAlreadyQueued = errors.New("a job for the same work is already queued")
+	ErrJobLeaseLost     = errors.New("job lease was lost to another worker")
+)
+
+const jobColumns = `id, kind, dedup_key, payload, status, attempts, max_attempts, run_at, locked_at, locked_by, last_error, created_at, updated_at, finished_at`
+
+func scanJob(row pgx.Row) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(
+		&job.ID, &job.Kind, &job.DedupKey, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&job.LockedAt, &job.LockedBy, &job.LastError, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// EnqueueJob queues a job of the given kind. When a job with the same kind and dedup key is already queued
+// the two are merged: the existing job is kept and brought forward if it was waiting on a retry.
+// Returns the id of the queued job.
+func EnqueueJob(ctx context.Context, pool *pgxpool.Pool, kind, dedupKey string, payload interface{}, maxAttempts int) (int64, error) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	query := `
+		INSERT INTO jobs (kind, dedup_key, payload, max_attempts)
+		VALUES ($1, NULLIF($2, ''), $3, $4)
+		ON CONFLICT (kind, dedup_key) WHERE status = 'queued'
+		DO UPDATE SET run_at = LEAST(jobs.run_at, EXCLUDED.run_at), updated_at = NOW()
+		RETURNING id
+	`
+	var id int64
+	if err := pool.QueryRow(ctx, query, kind, dedupKey, payloadJSON, maxAttempts).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	return id, nil
+}
+
+// ClaimJob locks the next due job for workerID and marks it running, or returns nil when there is nothing to do.
+// Jobs still running after lease are assumed to belong to a crashed worker and are claimed again. A job is
+// never claimed while another job with the same kind and dedup key is running.
+func ClaimJob(ctx context.Context, pool *pgxpool.Pool, workerID string, lease time.Duration) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW(), locked_by = $1, updated_at = NOW()
+		WHERE id = (
+			SELECT j.id FROM jobs j
+			WHERE ((j.status = 'queued' AND j.run_at <= NOW())
+				OR (j.status = 'running' AND j.locked_at < NOW() - make_interval(secs => $2)))
+				AND (j.dedup_key IS NULL OR NOT EXISTS (
+					SELECT 1 FROM jobs r
+					WHERE r.kind = j.kind AND r.dedup_key = j.dedup_key AND r.id <> j.id
+						AND r.status = 'running' AND r.locked_at >= NOW() - make_interval(secs => $2)
+				))
+			ORDER BY j.run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(pool.QueryRow(ctx, query, workerID, lease.Seconds()))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
+
+// CompleteJob marks a job the worker is running as succeeded. It returns ErrJobLeaseLost if the lease expired
+// and the job was reclaimed by another worker in the meantime.
+func CompleteJob(ctx context.Context, pool *pgxpool.Pool, jobID int64, workerID string) error {
+	query := `
+		UPDATE jobs
+		SET status = 'succeeded', last_error = NULL, locked_at = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`
+	tag, err := pool.Exec(ctx, query, jobID, workerID)
+	if err != nil {
+		return fmt.Errorf("failed to complete job %d: %w", jobID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
+
+// FailJob records a failed attempt. The job is retried after retryIn unless it has used up its attempts, in
+// which case it is dead-lettered. If the same work was queued again while this attempt ran, that newer job
+// takes over and this one is cancelled. Like CompleteJob, it returns ErrJobLeaseLost if another worker has
+// reclaimed the job.
+func FailJob(ctx context.Context, pool *pgxpool.Pool, jobID int64, workerID string, jobErr error, retryIn time.Duration) (string, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE
+				WHEN attempts >= max_attempts THEN 'dead'
+				WHEN dedup_key IS NOT NULL AND EXISTS (
+					SELECT 1 FROM jobs q WHERE q.kind = jobs.kind AND q.dedup_key = jobs.dedup_key AND q.status = 'queued'
+				) THEN 'cancelled'
+				ELSE 'queued'
+			END,
+			run_at = NOW() + make_interval(secs => $2),
+			last_error = $3,
+			locked_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND locked_by = $4 AND status = 'running'
+		RETURNING status
+	`
+	var status string
+	if err := pool.QueryRow(ctx, query, jobID, retryIn.Seconds(), jobErr.Error(), workerID).Scan(&status); err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrJobLeaseLost
+		}
+		return "", fmt.Errorf("failed to record job %d failure: %w", jobID, err)
+	}
+	if status != models.JobStatusQueued {
+		if _, err := pool.Exec(ctx, `UPDATE jobs SET finished_at = NOW() WHERE id = $1`, jobID); err != nil {
+			return status, fmt.Errorf("failed to finish job %d: %w", jobID, err)
+		}
+	}
+	return status, nil
+}
+
+// GetJobs returns one page of jobs matching the filter, newest first, along with the total match count.
+func GetJobs(ctx context.Context, pool *pgxpool.Pool, filter models.JobFilter) ([]models.Job, int64, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, strings.Replace(clause, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = ?", filter.Status)
+	}
+	if filter.Kind != "" {
+		addCondition("kind = ?", filter.Kind)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int64
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM jobs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := `SELECT ` + jobColumns + ` FROM jobs` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, total, rows.Err()
+}
+
+func GetJobByID(ctx context.Context, pool *pgxpool.Pool, jobID int64) (*models.Job, error) {
+	job, err := scanJob(pool.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, jobID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get job %d: %w", jobID, err)
+	}
+	return job, nil
+}
+
+// RetryJob puts a dead or cancelled job back in the queue with a fresh set of attempts.
+func RetryJob(ctx context.Context, pool *pgxpool.Pool, jobID int64) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', attempts = 0, run_at = NOW(), locked_at = NULL, locked_by = NULL,
+			finished_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status IN ('dead', 'cancelled')
+		RETURNING ` + jobColumns
+	job, err := scanJob(pool.QueryRow(ctx, query, jobID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		if strings.Contains(err.Error(), "duplicate key") {
+			return nil, ErrJobAlreadyQueued
+		}
+		return nil, fmt.Errorf("failed to retry job %d: %w", jobID, err)
+	}
+	return job, nil
+}
+
+// CancelJob cancels a job that has not started yet.
+func CancelJob(ctx context.Context, pool *pgxpool.Pool, jobID int64) (*models.Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'cancelled', finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'queued'
+		RETURNING ` + jobColumns
+	job, err := scanJob(pool.QueryRow(ctx, query, jobID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to cancel job %d: %w", jobID, err)
+	}
+	return job, nil
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReplaceItemLiabilities stores the item's liabilities, dropping any the institution no longer reports. It
+// returns the number of liabilities saved.
+func ReplaceItemLiabilities(ctx context.Context, pool *pgxpool.Pool, itemID string, liabilities []models.Liability) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	accountIDs, err := getItemAccountIDs(ctx, tx, itemID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM liabilities
+		WHERE account_id IN (
+			SELECT a.id FROM accounts a
+			JOIN plaid_items p ON a.item_id = p.id
+			WHERE p.item_id = $1
+		)
+	`, itemID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear liabilities: %w", err)
+	}
+
+	query := `
+		INSERT INTO liabilities (account_id, type, interest_rate_percentage, interest_rate_type, minimum_payment_amount,
+			next_payment_due_date, last_payment_amount, last_payment_date, last_statement_balance, last_statement_issue_date,
+			is_overdue, origination_date, origination_principal_amount, payoff_date, loan_term, loan_name, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+	`
+	batch := &pgx.Batch{}
+	saved := 0
+	for _, l := range liabilities {
+		accountID, ok := accountIDs[l.PlaidAccountID]
+		if !ok {
+			continue
+		}
+		details := l.Details
+		if details == nil {
+			details = []byte("{}")
+		}
+		batch.Queue(query,
+			accountID,
+			l.Type,
+			l.InterestRatePercentage,
+			l.InterestRateType,
+			l.MinimumPaymentAmount,
+			l.NextPaymentDueDate,
+			l.LastPaymentAmount,
+			l.LastPaymentDate,
+			l.LastStatementBalance,
+			l.LastStatementIssueDate,
+			l.IsOverdue,
+			l.OriginationDate,
+			l.OriginationPrincipalAmount,
+			l.PayoffDate,
+			l.LoanTerm,
+			l.LoanName,
+			string(details),
+		)
+		saved++
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("failed to save liabilities: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return saved, nil
+}
+
+// GetLiabilities returns the user's liabilities with the name and balance of their accounts, soonest due first.
+func GetLiabilities(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.Liability, error) {
+	query := `
+		SELECT l.id, l.account_id, l.type, l.interest_rate_percentage, l.interest_rate_type, l.minimum_payment_amount,
+			l.next_payment_due_date, l.last_payment_amount, l.last_payment_date, l.last_statement_balance,
+			l.last_statement_issue_date, l.is_overdue, l.origination_date, l.origination_principal_amount,
+			l.payoff_date, l.loan_term, l.loan_name, l.details, l.updated_at, a.name, COALESCE(a.current_balance, 0)
+		FROM liabilities l
+		JOIN accounts a ON l.account_id = a.id
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.user_id = $1
+		ORDER BY l.next_payment_due_date NULLS LAST, a.name
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query liabilities: %w", err)
+	}
+	defer rows.Close()
+
+	liabilities := []models.Liability{}
+	for rows.Next() {
+		var l models.Liability
+		err := rows.Scan(&l.ID, &l.AccountID, &l.Type, &l.InterestRatePercentage, &l.InterestRateType, &l.MinimumPaymentAmount,
+			&l.NextPaymentDueDate, &l.LastPaymentAmount, &l.LastPaymentDate, &l.LastStatementBalance,
+			&l.LastStatementIssueDate, &l.IsOverdue, &l.OriginationDate, &l.OriginationPrincipalAmount,
+			&l.PayoffDate, &l.LoanTerm, &l.LoanName, &l.Details, &l.UpdatedAt, &l.AccountName, &l.CurrentBalance)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan liability: %w", err)
+		}
+		liabilities = append(liabilities, l)
+	}
+	return liabilities, rows.Err()
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func InsertLoginEvent(ctx context.Context, pool *pgxpool.Pool, event models.LoginEvent) error {
+	query := `
+		INSERT INTO login_events (user_id, identifier, success, failure_reason, ip_address, ip_range, user_agent, device_fingerprint, new_device, new_ip_range)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := pool.Exec(ctx, query,
+		event.UserID,
+		event.Identifier,
+		event.Success,
+		event.FailureReason,
+		event.IPAddress,
+		event.IPRange,
+		event.UserAgent,
+		event.DeviceFingerprint,
+		event.NewDevice,
+		event.NewIPRange,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert login event: %w", err)
+	}
+	return nil
+}
+
+// GetKnownLoginOrigins reports whether the user has logged in successfully before, and if so whether
+// the given device fingerprint and IP range have been seen on any of those logins.
+func GetKnownLoginOrigins(ctx context.Context, pool *pgxpool.Pool, userID int64, fingerprint, ipRange string) (bool, bool, bool, error) {
+	query := `
+		SELECT
+			COUNT(*) > 0,
+			COALESCE(bool_or(device_fingerprint = $2), FALSE),
+			COALESCE(bool_or(ip_range = $3), FALSE)
+		FROM login_events
+		WHERE user_id = $1 AND success
+	`
+	var hasHistory, knownDevice, knownRange bool
+	err := pool.QueryRow(ctx, query, userID, fingerprint, ipRange).Scan(&hasHistory, &knownDevice, &knownRange)
+	if err != nil {
+		return false, false, false, fmt.Errorf("failed to query login history: %w", err)
+	}
+	return hasHistory, knownDevice, knownRange, nil
+}
+
+func GetLoginEventsForUser(ctx context.Context, pool *pgxpool.Pool, userID int64, limit int) ([]models.LoginEvent, error) {
+	query := `
+		SELECT id, user_id, identifier, success, failure_reason, ip_address, ip_range, user_agent, device_fingerprint, new_device, new_ip_range, created_at
+		FROM login_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	rows, err := pool.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query login events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.LoginEvent{}
+	for rows.Next() {
+		var e models.LoginEvent
+		err := rows.Scan(&e.ID, &e.UserID, &e.Identifier, &e.Success, &e.FailureReason, &e.IPAddress, &e.IPRange, &e.UserAgent, &e.DeviceFingerprint, &e.NewDevice, &e.NewIPRange, &e.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan login event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
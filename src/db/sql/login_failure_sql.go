@@ -0,0 +1,121 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RecordUserLoginFailure increments the failure counter for an account. Counters whose last failure is older
+// than window start again from one.
+func RecordUserLoginFailure(ctx context.Context, pool *pgxpool.Pool, userID int64, window time.Duration) (*models.LoginFailure, error) {
+	query := `
+		INSERT INTO login_failures (user_id, failure_count, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (user_id) WHERE user_id IS NOT NULL DO UPDATE
+		SET failure_count = CASE
+				WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_failures.failure_count + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING id, user_id, ip_address, failure_count, last_failure_at, created_at
+	`
+	var f models.LoginFailure
+	err := pool.QueryRow(ctx, query, userID, window.Seconds()).Scan(&f.ID, &f.UserID, &f.IPAddress, &f.FailureCount, &f.LastFailureAt, &f.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record user login failure: %w", err)
+	}
+	return &f, nil
+}
+
+// RecordIPLoginFailure increments the failure counter for a client IP address.
+func RecordIPLoginFailure(ctx context.Context, pool *pgxpool.Pool, ipAddress string, window time.Duration) (*models.LoginFailure, error) {
+	query := `
+		INSERT INTO login_failures (ip_address, failure_count, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (ip_address) WHERE ip_address IS NOT NULL DO UPDATE
+		SET failure_count = CASE
+				WHEN login_failures.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_failures.failure_count + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING id, user_id, ip_address, failure_count, last_failure_at, created_at
+	`
+	var f models.LoginFailure
+	err := pool.QueryRow(ctx, query, ipAddress, window.Seconds()).Scan(&f.ID, &f.UserID, &f.IPAddress, &f.FailureCount, &f.LastFailureAt, &f.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record ip login failure: %w", err)
+	}
+	return &f, nil
+}
+
+// GetUserLoginFailure returns the account's failure counter, or nil if it has none.
+func GetUserLoginFailure(ctx context.Context, pool *pgxpool.Pool, userID int64) (*models.LoginFailure, error) {
+	query := `SELECT id, user_id, ip_address, failure_count, last_failure_at, created_at FROM login_failures WHERE user_id = $1`
+	var f models.LoginFailure
+	err := pool.QueryRow(ctx, query, userID).Scan(&f.ID, &f.UserID, &f.IPAddress, &f.FailureCount, &f.LastFailureAt, &f.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user login failures: %w", err)
+	}
+	return &f, nil
+}
+
+// GetIPLoginFailure returns the IP address's failure counter, or nil if it has none.
+func GetIPLoginFailure(ctx context.Context, pool *pgxpool.Pool, ipAddress string) (*models.LoginFailure, error) {
+	query := `SELECT id, user_id, ip_address, failure_count, last_failure_at, created_at FROM login_failures WHERE ip_address = $1`
+	var f models.LoginFailure
+	err := pool.QueryRow(ctx, query, ipAddress).Scan(&f.ID, &f.UserID, &f.IPAddress, &f.FailureCount, &f.LastFailureAt, &f.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get ip login failures: %w", err)
+	}
+	return &f, nil
+}
+
+func GetAllLoginFailures(ctx context.Context, pool *pgxpool.Pool) ([]models.LoginFailure, error) {
+	query := `
+		SELECT id, user_id, ip_address, failure_count, last_failure_at, created_at
+		FROM login_failures
+		ORDER BY last_failure_at DESC
+	`
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query login failures: %w", err)
+	}
+	defer rows.Close()
+
+	var failures []models.LoginFailure
+	for rows.Next() {
+		var f models.LoginFailure
+		if err := rows.Scan(&f.ID, &f.UserID, &f.IPAddress, &f.FailureCount, &f.LastFailureAt, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan login failure: %w", err)
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
+
+func ClearUserLoginFailures(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	_, err := pool.Exec(ctx, `DELETE FROM login_failures WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear user login failures: %w", err)
+	}
+	return nil
+}
+
+func ClearIPLoginFailures(ctx context.Context, pool *pgxpool.Pool, ipAddress string) error {
+	_, err := pool.Exec(ctx, `DELETE FROM login_failures WHERE ip_address = $1`, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to clear ip login failures: %w", err)
+	}
+	return nil
+}
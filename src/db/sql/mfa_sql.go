@@ -0,0 +1,221 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SetPendingTOTPSecret encrypts and stores a new, unconfirmed TOTP secret. It fails if two-factor authentication
+// is already enabled.
+func SetPendingTOTPSecret(ctx context.Context, pool *pgxpool.Pool, userID int64, secret string) error {
+	encryptedSecret, err := util.EncryptSecret(secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+
+	query := `
+		UPDATE users
+		SET totp_secret = $1, totp_enabled = FALSE, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $2 AND totp_enabled = FALSE
+	`
+	cmd, err := pool.Exec(ctx, query, encryptedSecret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to store totp secret: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+// EnableTOTP marks the pending secret as confirmed and replaces the user's recovery codes.
+func EnableTOTP(ctx context.Context, pool *pgxpool.Pool, userID int64, step int64, recoveryCodeHashes []string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin totp transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET totp_enabled = TRUE, totp_last_step = $1, updated_at = NOW()
+		WHERE id = $2 AND totp_secret IS NOT NULL
+	`
+	cmd, err := tx.Exec(ctx, query, step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable totp: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("no pending totp secret")
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func DisableTOTP(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin totp transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE users
+		SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL, updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to disable totp: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeTOTPStep records the time step of an accepted code. It returns false if that step (or a later one)
+// was already used, which stops a captured code from being replayed inside its validity window.
+func ConsumeTOTPStep(ctx context.Context, pool *pgxpool.Pool, userID int64, step int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)
+	`
+	cmd, err := pool.Exec(ctx, query, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+// ConsumeRecoveryCode marks a matching unused recovery code as used. It returns false if none matched.
+func ConsumeRecoveryCode(ctx context.Context, pool *pgxpool.Pool, userID int64, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM mfa_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)
+	`
+	cmd, err := pool.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+func RegenerateRecoveryCodes(ctx context.Context, pool *pgxpool.Pool, userID int64, recoveryCodeHashes []string) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin recovery code transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int64, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// DecryptTOTPSecret returns the user's TOTP secret in plaintext. User lookups leave the secret encrypted, it is
+// only decrypted where a code is checked, so a key problem cannot make the user impossible to load.
+func DecryptTOTPSecret(user *models.User) (string, error) {
+	if user.TOTPSecret == nil {
+		return "", fmt.Errorf("user %d has no totp secret", user.ID)
+	}
+	secret, err := decryptStoredTOTPSecret(*user.TOTPSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret for user %d: %w", user.ID, err)
+	}
+	return secret, nil
+}
+
+// decryptStoredTOTPSecret decrypts a stored TOTP secret. Secrets have always been stored encrypted, so a
+// plaintext value is rejected rather than trusted.
+func decryptStoredTOTPSecret(value string) (string, error) {
+	if !util.IsEncryptedSecret(value) {
+		return "", errors.New("totp secret is not encrypted")
+	}
+	return util.DecryptSecret(value)
+}
+
+// ReencryptTOTPSecrets rewrites every TOTP secret encrypted with a retired key so it is encrypted with the
+// active key. Returns the number of users that were rewritten.
+func ReencryptTOTPSecrets(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id, totp_secret FROM users WHERE totp_secret IS NOT NULL FOR UPDATE`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query totp secrets: %w", err)
+	}
+
+	type storedSecret struct {
+		id    int64
+		value string
+	}
+	var stale []storedSecret
+	for rows.Next() {
+		var s storedSecret
+		if err := rows.Scan(&s.id, &s.value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan totp secret: %w", err)
+		}
+		if util.SecretNeedsRotation(s.value) {
+			stale = append(stale, s)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read totp secrets: %w", err)
+	}
+
+	for _, s := range stale {
+		plaintext, err := decryptStoredTOTPSecret(s.value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt totp secret for user %d: %w", s.id, err)
+		}
+		encrypted, err := util.EncryptSecret(plaintext)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt totp secret for user %d: %w", s.id, err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE users SET totp_secret = $1, updated_at = NOW() WHERE id = $2`, encrypted, s.id); err != nil {
+			return 0, fmt.Errorf("failed to update user %d: %w", s.id, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(stale), nil
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInvalidOIDCState = errors.New("oidc state is invalid or expired")
+	ErrIdentityNotFound = errors.New("identity not found")
+)
+
+func CreateOIDCLoginState(ctx context.Context, pool *pgxpool.Pool, stateHash string, state models.OIDCLoginState, ttl time.Duration) error {
+	// Clear out abandoned attempts while we are here
+	if _, err := pool.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to clean up oidc states: %w", err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, invite_code_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := pool.Exec(ctx, query, stateHash, state.Provider, state.Nonce, state.CodeVerifier, state.InviteCodeHash, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return fmt.Errorf("failed to create oidc state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState deletes and returns a pending state, so each state can complete at most one login.
+func ConsumeOIDCLoginState(ctx context.Context, pool *pgxpool.Pool, stateHash, provider string) (*models.OIDCLoginState, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > NOW()
+		RETURNING provider, nonce, code_verifier, invite_code_hash
+	`
+	var state models.OIDCLoginState
+	err := pool.QueryRow(ctx, query, stateHash, provider).Scan(&state.Provider, &state.Nonce, &state.CodeVerifier, &state.InviteCodeHash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume oidc state: %w", err)
+	}
+	return &state, nil
+}
+
+// GetUserIDByIdentity returns the local user linked to a provider account.
+func GetUserIDByIdentity(ctx context.Context, pool *pgxpool.Pool, provider, subject string) (int64, error) {
+	var userID int64
+	err := pool.QueryRow(ctx, `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`, provider, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrIdentityNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query identity: %w", err)
+	}
+	return userID, nil
+}
+
+// LinkUserIdentity records that a provider account belongs to the user, refreshing the email and last login time.
+func LinkUserIdentity(ctx context.Context, pool *pgxpool.Pool, userID int64, provider, subject, email string) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email, last_login_at = NOW()
+		WHERE user_identities.user_id = EXCLUDED.user_id
+	`
+	_, err := pool.Exec(ctx, query, userID, provider, subject, email)
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+func GetIdentitiesForUser(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, last_login_at, created_at
+		FROM user_identities WHERE user_id = $1 ORDER BY created_at
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		var i models.UserIdentity
+		if err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.LastLoginAt, &i.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func UnlinkUserIdentity(ctx context.Context, pool *pgxpool.Pool, userID, identityID int64) error {
+	cmd, err := pool.Exec(ctx, `DELETE FROM user_identities WHERE id = $1 AND user_id = $2`, identityID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
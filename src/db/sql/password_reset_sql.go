@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// CreatePasswordResetToken stores the hash of a new reset token and invalidates any earlier unused tokens for the user.
+func CreatePasswordResetToken(ctx context.Context, pool *pgxpool.Pool, userID int64, tokenHash string, ttl time.Duration) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin password reset transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate previous reset tokens: %w", err)
+	}
+
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	_, err = tx.Exec(ctx, query, userID, tokenHash, time.Now().UTC().Add(ttl))
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ResetPasswordWithToken consumes a reset token and sets the new password hash in one transaction.
+// It returns the ID of the user whose password was changed.
+func ResetPasswordWithToken(ctx context.Context, pool *pgxpool.Pool, tokenHash string, hashedPassword string) (int64, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin password reset transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT id, user_id, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+	var (
+		tokenID   int64
+		userID    int64
+		expiresAt time.Time
+		usedAt    *time.Time
+	)
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("failed to look up password reset token: %w", err)
+	}
+
+	if usedAt != nil || time.Now().UTC().After(expiresAt) {
+		return 0, ErrInvalidResetToken
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1`, tokenID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark password reset token used: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`, hashedPassword, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user password: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	return userID, nil
+}
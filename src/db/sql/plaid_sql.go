@@ -6,20 +6,50 @@ import (
 	"budgee-server/src/util"
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/plaid/plaid-go/v41/plaid"
 )
 
-func GetPlaidItemsSQL(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.PlaidItem, error) {
-	cacheKey := "items_user_" + fmt.Sprint(userID)
-	if val, found := db.Cache.Get(cacheKey); found {
-		return val.([]models.PlaidItem), nil
+const plaidItemColumns = `id, user_id, access_token, item_id, institution_id, institution_name, created_at,
+	status, error_code, error_message, consent_expiration_time, new_accounts_available, status_updated_at`
+
+// scanPlaidItem reads a row selected with plaidItemColumns and decrypts its access token
+func scanPlaidItem(row pgx.Row) (*models.PlaidItem, error) {
+	item, err := scanEncryptedPlaidItem(row)
+	if err != nil {
+		return nil, err
 	}
+	item.AccessToken, err = util.DecryptSecret(item.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt access token for item %s: %w", item.ItemID, err)
+	}
+	return item, nil
+}
 
-	query := `SELECT id, user_id, access_token, item_id, institution_id, institution_name, created_at FROM plaid_items WHERE user_id = $1`
+// scanEncryptedPlaidItem reads a row selected with plaidItemColumns, leaving the access token encrypted
+func scanEncryptedPlaidItem(row pgx.Row) (*models.PlaidItem, error) {
+	var item models.PlaidItem
+	err := row.Scan(
+		&item.ID, &item.UserID, &item.AccessToken, &item.ItemID, &item.InstitutionID, &item.InstitutionName, &item.CreatedAt,
+		&item.Status, &item.ErrorCode, &item.ErrorMessage, &item.ConsentExpirationTime, &item.NewAccountsAvailable, &item.StatusUpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// queryCachedPlaidItems returns the items the query selects. Items are cached with their access tokens still
+// encrypted, so no plaintext token sits in the process-wide cache; callers get copies with the tokens decrypted.
+func queryCachedPlaidItems(ctx context.Context, pool *pgxpool.Pool, cacheKey, query string, args ...interface{}) ([]models.PlaidItem, error) {
+	if val, found := db.Cache.Get(cacheKey); found {
+		return decryptPlaidItems(val.([]models.PlaidItem))
+	}
 
-	rows, err := pool.Query(ctx, query, userID)
+	rows, err := pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -27,16 +57,40 @@ func GetPlaidItemsSQL(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]
 
 	var items []models.PlaidItem
 	for rows.Next() {
-		var item models.PlaidItem
-		err := rows.Scan(&item.ID, &item.UserID, &item.AccessToken, &item.ItemID, &item.InstitutionID, &item.InstitutionName, &item.CreatedAt)
+		item, err := scanEncryptedPlaidItem(rows)
 		if err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		items = append(items, *item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
 	db.SetItemCache(cacheKey, items)
-	return items, rows.Err()
+	return decryptPlaidItems(items)
+}
+
+// decryptPlaidItems copies the items with their access tokens decrypted, leaving the originals untouched
+func decryptPlaidItems(items []models.PlaidItem) ([]models.PlaidItem, error) {
+	if items == nil {
+		return nil, nil
+	}
+	decrypted := make([]models.PlaidItem, len(items))
+	for i, item := range items {
+		token, err := util.DecryptSecret(item.AccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt access token for item %s: %w", item.ItemID, err)
+		}
+		item.AccessToken = token
+		decrypted[i] = item
+	}
+	return decrypted, nil
+}
+
+func GetPlaidItemsSQL(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.PlaidItem, error) {
+	query := `SELECT ` + plaidItemColumns + ` FROM plaid_items WHERE user_id = $1`
+	return queryCachedPlaidItems(ctx, pool, "items_user_"+fmt.Sprint(userID), query, userID)
 }
 
 func GetAccountsForUserAndItemSQL(ctx context.Context, pool *pgxpool.Pool, userID int64, itemID string) ([]models.Account, error) {
@@ -116,7 +170,8 @@ func GetTransactionsSQL(ctx context.Context, pool *pgxpool.Pool, userID int64, a
 	query := `
 		   SELECT 
 			   t.id, t.account_id, t.transaction_id, t.primary_category, t.detailed_category, t.payment_channel, t.type, t.name, t.merchant_name,
-			   t.amount, t.currency, t.date, t.pending, t.expense, t.income, t.account_owner, t.personal_finance_category_icon_url, t.created_at, t.updated_at
+			   t.amount, t.currency, t.date, t.pending, t.expense, t.income, t.account_owner, t.personal_finance_category_icon_url, t.created_at, t.updated_at,
+			   t.user_overridden_fields, t.pending_transaction_id, t.pending_transaction
 		FROM transactions t
 		JOIN accounts a ON t.account_id = a.id
 		JOIN plaid_items p ON a.item_id = p.id
@@ -153,6 +208,9 @@ func GetTransactionsSQL(ctx context.Context, pool *pgxpool.Pool, userID int64, a
 			&transaction.PersonalFinanceCategoryIconURL,
 			&transaction.CreatedAt,
 			&transaction.UpdatedAt,
+			&transaction.UserOverriddenFields,
+			&transaction.PendingTransactionID,
+			&transaction.PendingTransaction,
 		)
 		if err != nil {
 			return nil, err
@@ -164,139 +222,6 @@ func GetTransactionsSQL(ctx context.Context, pool *pgxpool.Pool, userID int64, a
 	return transactions, rows.Err()
 }
 
-func SaveTransactions(ctx context.Context, pool *pgxpool.Pool, userID int64, transactions []plaid.Transaction) error {
-	for _, txn := range transactions {
-		query := `
-				INSERT INTO transactions (account_id, transaction_id, amount, name, date, primary_category, detailed_category, payment_channel, pending, expense, income, type, merchant_name, currency, account_owner, personal_finance_category_icon_url, created_at)
-				SELECT a.id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NOW()
-				FROM accounts a
-				JOIN plaid_items p ON a.item_id = p.id
-				WHERE p.user_id = $17 AND a.account_id = $1
-				ON CONFLICT (transaction_id) DO NOTHING
-			`
-
-		primaryCategory := ""
-		detailedCategory := ""
-		iconURL := ""
-		if txn.PersonalFinanceCategory.IsSet() {
-			primaryCategory = txn.GetPersonalFinanceCategory().Primary
-			detailedCategory = txn.GetPersonalFinanceCategory().Detailed
-			iconURL = txn.GetPersonalFinanceCategoryIconUrl()
-		}
-
-		accountType, err := GetAccountTypeByAccountID(ctx, pool, txn.GetAccountId())
-		if err != nil {
-			return err
-		}
-		expense := util.IsExpense(accountType, txn.GetAmount(), primaryCategory)
-		income := util.IsIncome(accountType, txn.GetAmount(), primaryCategory)
-
-		_, err = pool.Exec(ctx, query,
-			txn.GetAccountId(),       // $1
-			txn.GetTransactionId(),   // $2
-			txn.GetAmount(),          // $3
-			txn.GetName(),            // $4
-			txn.GetDate(),            // $5
-			primaryCategory,          // $6
-			detailedCategory,         // $7
-			txn.GetPaymentChannel(),  // $8
-			txn.GetPending(),         // $9
-			expense,                  // $10
-			income,                   // $11
-			txn.GetTransactionType(), // $12
-			txn.GetMerchantName(),    // $13
-			txn.GetIsoCurrencyCode(), // $14
-			txn.GetAccountOwner(),    // $15
-			iconURL,                  // $16
-			userID,                   // $17
-		)
-		if err != nil {
-			return err
-		}
-	}
-
-	db.ClearAllTransactionCaches()
-	return nil
-}
-
-func UpdateTransactions(ctx context.Context, pool *pgxpool.Pool, userID int64, transactions []plaid.Transaction) error {
-	for _, txn := range transactions {
-		query := `
-			UPDATE transactions
-			SET amount = $1, name = $2, date = $3, primary_category = $4, detailed_category = $5, payment_channel = $6, pending = $7, merchant_name = $8, currency = $9, account_owner = $10, personal_finance_category_icon_url = $11, expense = $12, income = $13, updated_at = NOW()
-			WHERE transaction_id = $14 AND account_id IN (
-				SELECT a.id FROM accounts a
-				JOIN plaid_items p ON a.item_id = p.id
-				WHERE p.user_id = $15
-			)
-		`
-
-		primaryCategory := ""
-		detailedCategory := ""
-		iconURL := ""
-		if txn.PersonalFinanceCategory.IsSet() {
-			primaryCategory = txn.GetPersonalFinanceCategory().Primary
-			detailedCategory = txn.GetPersonalFinanceCategory().Detailed
-			iconURL = txn.GetPersonalFinanceCategoryIconUrl()
-		}
-
-		accountType, err := GetAccountTypeByAccountID(ctx, pool, txn.GetAccountId())
-		if err != nil {
-			return err
-		}
-		expense := util.IsExpense(accountType, txn.GetAmount(), primaryCategory)
-		income := util.IsIncome(accountType, txn.GetAmount(), primaryCategory)
-
-		_, err = pool.Exec(ctx, query,
-			txn.GetAmount(),          // $1
-			txn.GetName(),            // $2
-			txn.GetDate(),            // $3
-			primaryCategory,          // $4
-			detailedCategory,         // $5
-			txn.GetPaymentChannel(),  // $6
-			txn.GetPending(),         // $7
-			txn.GetMerchantName(),    // $8
-			txn.GetIsoCurrencyCode(), // $9
-			txn.GetAccountOwner(),    // $10
-			iconURL,                  // $11
-			expense,                  // $12
-			income,                   // $13
-			txn.GetTransactionId(),   // $14
-			userID,                   // $15
-		)
-		if err != nil {
-			return err
-		}
-	}
-
-	db.ClearAllTransactionCaches()
-	return nil
-}
-
-func RemoveTransactions(ctx context.Context, pool *pgxpool.Pool, userID int64, removedTransactions []plaid.RemovedTransaction) error {
-	for _, txn := range removedTransactions {
-		query := `
-			DELETE FROM transactions
-			WHERE transaction_id = $1 AND account_id IN (
-				SELECT a.id FROM accounts a
-				JOIN plaid_items p ON a.item_id = p.id
-				WHERE p.user_id = $2
-			)
-		`
-
-		_, err := pool.Exec(ctx, query,
-			txn.GetTransactionId(),
-			userID,
-		)
-		if err != nil {
-			return err
-		}
-	}
-
-	db.ClearAllTransactionCaches()
-	return nil
-}
-
 func GetSyncCursor(ctx context.Context, pool *pgxpool.Pool, itemID int64) (string, error) {
 	query := `SELECT COALESCE(sync_cursor, '') FROM plaid_items WHERE id = $1`
 	var cursor string
@@ -307,12 +232,6 @@ func GetSyncCursor(ctx context.Context, pool *pgxpool.Pool, itemID int64) (strin
 	return cursor, nil
 }
 
-func UpdateSyncCursor(ctx context.Context, pool *pgxpool.Pool, itemID int64, cursor string) error {
-	query := `UPDATE plaid_items SET sync_cursor = $1 WHERE id = $2`
-	_, err := pool.Exec(ctx, query, cursor, itemID)
-	return err
-}
-
 func SavePlaidItem(ctx context.Context, pool *pgxpool.Pool, userID int64, itemID, accessToken, institutionID, institutionName string) error {
 	query := `
 		INSERT INTO plaid_items (user_id, item_id, access_token, institution_id, institution_name, status)
@@ -320,7 +239,12 @@ func SavePlaidItem(ctx context.Context, pool *pgxpool.Pool, userID int64, itemID
 		ON CONFLICT (item_id) DO NOTHING
 	`
 
-	_, err := pool.Exec(ctx, query, userID, itemID, accessToken, institutionID, institutionName, "active")
+	encryptedToken, err := util.EncryptSecret(accessToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+
+	_, err = pool.Exec(ctx, query, userID, itemID, encryptedToken, institutionID, institutionName, models.ItemStatusActive)
 	db.DelItemCache("items_user_" + fmt.Sprint(userID))
 	db.DelItemCache("items_all")
 	return err
@@ -386,40 +310,78 @@ func DeletePlaidItem(ctx context.Context, pool *pgxpool.Pool, itemID string, use
 }
 
 func GetAllPlaidItems(ctx context.Context, pool *pgxpool.Pool) ([]models.PlaidItem, error) {
-	cacheKey := "items_all"
-	if val, found := db.Cache.Get(cacheKey); found {
-		return val.([]models.PlaidItem), nil
+	query := `SELECT ` + plaidItemColumns + ` FROM plaid_items`
+	return queryCachedPlaidItems(ctx, pool, "items_all", query)
+}
+
+func GetPlaidItemByItemID(ctx context.Context, pool *pgxpool.Pool, itemID string) (*models.PlaidItem, error) {
+	query := `SELECT ` + plaidItemColumns + ` FROM plaid_items WHERE item_id = $1`
+	return scanPlaidItem(pool.QueryRow(ctx, query, itemID))
+}
+
+func GetPlaidItemByID(ctx context.Context, pool *pgxpool.Pool, id string) (*models.PlaidItem, error) {
+	query := `SELECT ` + plaidItemColumns + ` FROM plaid_items WHERE id = $1`
+	return scanPlaidItem(pool.QueryRow(ctx, query, id))
+}
+
+func GetPlaidItemForUser(ctx context.Context, pool *pgxpool.Pool, userID int64, id string) (*models.PlaidItem, error) {
+	query := `SELECT ` + plaidItemColumns + ` FROM plaid_items WHERE user_id = $1 AND id = $2`
+	return scanPlaidItem(pool.QueryRow(ctx, query, userID, id))
+}
+
+// ReencryptPlaidAccessTokens rewrites every access token that is still plaintext or encrypted with a retired key
+// so it is encrypted with the active key. Returns the number of items that were rewritten.
+func ReencryptPlaidAccessTokens(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	query := `SELECT id, user_id, access_token, item_id, institution_id, institution_name, created_at FROM plaid_items`
-	rows, err := pool.Query(ctx, query)
+	rows, err := tx.Query(ctx, `SELECT id, access_token FROM plaid_items FOR UPDATE`)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("failed to query plaid items: %w", err)
 	}
-	defer rows.Close()
 
-	var items []models.PlaidItem
+	type storedToken struct {
+		id    int64
+		value string
+	}
+	var stale []storedToken
 	for rows.Next() {
-		var item models.PlaidItem
-		err := rows.Scan(&item.ID, &item.UserID, &item.AccessToken, &item.ItemID, &item.InstitutionID, &item.InstitutionName, &item.CreatedAt)
-		if err != nil {
-			return nil, err
+		var t storedToken
+		if err := rows.Scan(&t.id, &t.value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan plaid item: %w", err)
+		}
+		if util.SecretNeedsRotation(t.value) {
+			stale = append(stale, t)
 		}
-		items = append(items, item)
 	}
-	db.SetItemCache(cacheKey, items)
-	return items, rows.Err()
-}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read plaid items: %w", err)
+	}
 
-func GetPlaidItemByItemID(ctx context.Context, pool *pgxpool.Pool, itemID string) (*models.PlaidItem, error) {
-	query := `SELECT id, user_id, access_token, item_id, institution_id, institution_name, created_at FROM plaid_items WHERE item_id = $1`
+	for _, t := range stale {
+		plaintext, err := util.DecryptSecret(t.value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt access token for plaid item %d: %w", t.id, err)
+		}
+		encrypted, err := util.EncryptSecret(plaintext)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt access token for plaid item %d: %w", t.id, err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE plaid_items SET access_token = $1, updated_at = NOW() WHERE id = $2`, encrypted, t.id); err != nil {
+			return 0, fmt.Errorf("failed to update plaid item %d: %w", t.id, err)
+		}
+	}
 
-	var item models.PlaidItem
-	err := pool.QueryRow(ctx, query, itemID).Scan(&item.ID, &item.UserID, &item.AccessToken, &item.ItemID, &item.InstitutionID, &item.InstitutionName, &item.CreatedAt)
-	if err != nil {
-		return nil, err
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
-	return &item, nil
+
+	return len(stale), nil
 }
 
 func GetAccountTypeByAccountID(ctx context.Context, pool *pgxpool.Pool, accountID string) (string, error) {
@@ -529,7 +491,7 @@ func InsertTransaction(ctx context.Context, pool *pgxpool.Pool, accountID int64,
 			(account_id, amount, date, name, merchant_name, primary_category, detailed_category, payment_channel, expense, income, created_at, updated_at)
 		VALUES
 			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW())
-		RETURNING id, account_id, transaction_id, primary_category, detailed_category, payment_channel, type, name, merchant_name, amount, currency, date, pending, expense, income, account_owner, personal_finance_category_icon_url, created_at, updated_at
+		RETURNING id, account_id, transaction_id, primary_category, detailed_category, payment_channel, type, name, merchant_name, amount, currency, date, pending, expense, income, account_owner, personal_finance_category_icon_url, created_at, updated_at, user_overridden_fields
 	`
 	var txn models.Transaction
 
@@ -573,21 +535,85 @@ func InsertTransaction(ctx context.Context, pool *pgxpool.Pool, accountID int64,
 		&txn.PersonalFinanceCategoryIconURL,
 		&txn.CreatedAt,
 		&txn.UpdatedAt,
+		&txn.UserOverriddenFields,
 	)
 	return txn, err
 }
 
+// UpdateTransaction applies a user's edit. Every field whose value changes is marked as overridden, and the
+// value it had before the first override is kept in plaid_values so it can be restored later.
 func UpdateTransaction(ctx context.Context, pool *pgxpool.Pool, transactionID int, req models.UpdateTransactionRequest, userID int64, accountID int64) error {
 	updateQuery := `
-		UPDATE transactions
-		SET amount = $1, primary_category = $2, detailed_category = $3, merchant_name = $4, date = $5, payment_channel = $6, personal_finance_category_icon_url = $7, updated_at = NOW()
-		WHERE id = $8
+		WITH edited AS (
+			SELECT id, ARRAY_REMOVE(ARRAY[
+				CASE WHEN amount <> $1::numeric THEN 'amount' END,
+				CASE WHEN COALESCE(primary_category, '') <> $2 THEN 'primary_category' END,
+				CASE WHEN COALESCE(detailed_category, '') <> $3 THEN 'detailed_category' END,
+				CASE WHEN COALESCE(merchant_name, '') <> $4 THEN 'merchant_name' END,
+				CASE WHEN date <> $5::date THEN 'date' END,
+				CASE WHEN COALESCE(payment_channel, '') <> $6 THEN 'payment_channel' END,
+				CASE WHEN COALESCE(personal_finance_category_icon_url, '') <> $7 THEN 'personal_finance_category_icon_url' END
+			], NULL) AS fields
+			FROM transactions
+			WHERE id = $8
+		)
+		UPDATE transactions t
+		SET plaid_values = t.plaid_values || (
+				SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb)
+				FROM jsonb_each(jsonb_build_object(
+					'amount', t.amount,
+					'primary_category', t.primary_category,
+					'detailed_category', t.detailed_category,
+					'merchant_name', t.merchant_name,
+					'date', t.date,
+					'payment_channel', t.payment_channel,
+					'personal_finance_category_icon_url', t.personal_finance_category_icon_url
+				))
+				WHERE key = ANY(e.fields) AND NOT key = ANY(t.user_overridden_fields)
+			),
+			user_overridden_fields = ARRAY(SELECT DISTINCT unnest(t.user_overridden_fields || e.fields)),
+			amount = $1, primary_category = $2, detailed_category = $3, merchant_name = $4, date = $5, payment_channel = $6, personal_finance_category_icon_url = $7, updated_at = NOW()
+		FROM edited e
+		WHERE t.id = e.id
 	`
 	_, err := pool.Exec(ctx, updateQuery, req.Amount, req.PrimaryCategory, req.DetailedCategory, req.MerchantName, req.Date, req.PaymentChannel, req.PersonalFinanceCategoryIconURL, transactionID)
 	db.DelTransactionCache("transactions_account_user_" + fmt.Sprint(userID) + fmt.Sprint("_") + fmt.Sprint(accountID))
 	return err
 }
 
+// ResetTransactionOverrides puts the given overridden fields back to the last value Plaid reported for them
+// and lets future syncs and rules update them again. Fields that are not overridden are left as they are.
+func ResetTransactionOverrides(ctx context.Context, pool *pgxpool.Pool, transactionID int, fields []string, userID int64, accountID int64) error {
+	restore := map[string]string{
+		"amount": "(plaid_values->>'amount')::numeric",
+		"date":   "(plaid_values->>'date')::date",
+	}
+
+	var sets []string
+	for _, field := range models.OverridableTransactionFields {
+		value, ok := restore[field]
+		if !ok {
+			value = fmt.Sprintf("plaid_values->>'%s'", field)
+		}
+		sets = append(sets, fmt.Sprintf("%[1]s = CASE WHEN '%[1]s' = ANY($2::text[]) AND '%[1]s' = ANY(user_overridden_fields) AND plaid_values ? '%[1]s' THEN %[2]s ELSE %[1]s END", field, value))
+	}
+
+	query := `
+		UPDATE transactions
+		SET ` + strings.Join(sets, ",\n\t\t\t") + `,
+			user_overridden_fields = ARRAY(SELECT unnest(user_overridden_fields) EXCEPT SELECT unnest($2::text[])),
+			plaid_values = plaid_values - $2::text[],
+			updated_at = NOW()
+		WHERE id = $1
+	`
+	_, err := pool.Exec(ctx, query, transactionID, fields)
+	if err != nil {
+		return fmt.Errorf("failed to reset transaction overrides: %w", err)
+	}
+	db.DelTransactionCache("transactions_account_user_" + fmt.Sprint(userID) + fmt.Sprint("_") + fmt.Sprint(accountID))
+	return nil
+}
+
 func DeleteTransaction(ctx context.Context, pool *pgxpool.Pool, transactionID int, userID int64, accountID int64) error {
 	_, err := pool.Exec(ctx, "DELETE FROM transactions WHERE id = $1", transactionID)
 	db.DelTransactionCache("transactions_account_user_" + fmt.Sprint(userID) + fmt.Sprint("_") + fmt.Sprint(accountID))
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetRecurringCandidateTransactions returns the user's posted transactions since the given date, oldest
+// first, with the fields recurring stream detection looks at.
+func GetRecurringCandidateTransactions(ctx context.Context, pool *pgxpool.Pool, userID int64, since time.Time) ([]models.Transaction, error) {
+	query := `
+		SELECT t.id, t.account_id, t.transaction_id, t.name, t.merchant_name, t.amount, t.date, t.primary_category
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.user_id = $1 AND NOT t.pending AND t.date >= $2
+		ORDER BY t.date, t.id
+	`
+	rows, err := pool.Query(ctx, query, userID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		var t models.Transaction
+		if err := rows.Scan(&t.ID, &t.AccountID, &t.TransactionID, &t.Name, &t.MerchantName, &t.Amount, &t.Date, &t.PrimaryCategory); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// GetRecurringStreams returns the user's recurring streams, active ones first and then by their next
+// expected date.
+func GetRecurringStreams(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.RecurringStream, error) {
+	query := `
+		SELECT r.id, r.user_id, r.account_id, a.name, r.source, r.plaid_stream_id, r.merchant_key, r.merchant_name,
+			r.category, r.direction, r.frequency, r.average_amount, r.last_amount, r.previous_amount, r.price_changed_on,
+			r.first_date, r.last_date, r.next_expected_date, r.transaction_count, r.status, r.created_at, r.updated_at
+		FROM recurring_streams r
+		JOIN accounts a ON r.account_id = a.id
+		WHERE r.user_id = $1
+		ORDER BY r.status = 'active' DESC, r.next_expected_date NULLS LAST, r.merchant_name
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring streams: %w", err)
+	}
+	defer rows.Close()
+
+	streams := []models.RecurringStream{}
+	for rows.Next() {
+		var s models.RecurringStream
+		err := rows.Scan(&s.ID, &s.UserID, &s.AccountID, &s.AccountName, &s.Source, &s.PlaidStreamID, &s.MerchantKey, &s.MerchantName,
+			&s.Category, &s.Direction, &s.Frequency, &s.AverageAmount, &s.LastAmount, &s.PreviousAmount, &s.PriceChangedOn,
+			&s.FirstDate, &s.LastDate, &s.NextExpectedDate, &s.TransactionCount, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring stream: %w", err)
+		}
+		streams = append(streams, s)
+	}
+	return streams, rows.Err()
+}
+
+// SaveRecurringStreams makes the given streams the user's recurring streams. Streams with an ID are updated in
+// place, the others are inserted, and any stored stream that is not in the list is deleted.
+func SaveRecurringStreams(ctx context.Context, pool *pgxpool.Pool, userID int64, streams []models.RecurringStream) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	keep := []int{}
+	for _, s := range streams {
+		if s.ID != 0 {
+			keep = append(keep, s.ID)
+		}
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM recurring_streams WHERE user_id = $1 AND NOT (id = ANY($2))`, userID, keep)
+	if err != nil {
+		return fmt.Errorf("failed to delete stale recurring streams: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO recurring_streams (user_id, account_id, source, plaid_stream_id, merchant_key, merchant_name, category,
+			direction, frequency, average_amount, last_amount, previous_amount, price_changed_on, first_date, last_date,
+			next_expected_date, transaction_count, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+	`
+	updateQuery := `
+		UPDATE recurring_streams
+		SET account_id = $2, source = $3, plaid_stream_id = $4, merchant_key = $5, merchant_name = $6, category = $7,
+			direction = $8, frequency = $9, average_amount = $10, last_amount = $11, previous_amount = $12,
+			price_changed_on = $13, first_date = $14, last_date = $15, next_expected_date = $16, transaction_count = $17,
+			status = $18, updated_at = NOW()
+		WHERE id = $19 AND user_id = $1
+	`
+	batch := &pgx.Batch{}
+	for _, s := range streams {
+		args := []interface{}{
+			userID,
+			s.AccountID,
+			s.Source,
+			s.PlaidStreamID,
+			s.MerchantKey,
+			s.MerchantName,
+			s.Category,
+			s.Direction,
+			s.Frequency,
+			s.AverageAmount,
+			s.LastAmount,
+			s.PreviousAmount,
+			s.PriceChangedOn,
+			s.FirstDate,
+			s.LastDate,
+			s.NextExpectedDate,
+			s.TransactionCount,
+			s.Status,
+		}
+		if s.ID != 0 {
+			batch.Queue(updateQuery, append(args, s.ID)...)
+		} else {
+			batch.Queue(insertQuery, args...)
+		}
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save recurring streams: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+func scanRoles(rows pgx.Rows) ([]models.Role, error) {
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func GetRoles(ctx context.Context, pool *pgxpool.Pool) ([]models.Role, error) {
+	query := `
+		SELECT r.id, r.name, r.description, COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}'), r.created_at
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		GROUP BY r.id
+		ORDER BY r.id
+	`
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	return scanRoles(rows)
+}
+
+func GetRolesForUser(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.Role, error) {
+	query := `
+		SELECT r.id, r.name, r.description, COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}'), r.created_at
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		WHERE ur.user_id = $1
+		GROUP BY r.id
+		ORDER BY r.id
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles for user: %w", err)
+	}
+	return scanRoles(rows)
+}
+
+// GetUserPermissions returns the union of permissions from the user's roles. Super admins hold every permission.
+func GetUserPermissions(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]string, error) {
+	var superAdmin bool
+	err := pool.QueryRow(ctx, `SELECT super_admin FROM users WHERE id = $1`, userID).Scan(&superAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	if superAdmin {
+		return models.AllPermissions, nil
+	}
+
+	query := `
+		SELECT DISTINCT rp.permission
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		WHERE ur.user_id = $1
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, fmt.Errorf("failed to scan permission: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func AssignRole(ctx context.Context, pool *pgxpool.Pool, userID int64, roleName string, grantedBy int64) error {
+	query := `
+		INSERT INTO user_roles (user_id, role_id, granted_by)
+		SELECT $1, id, $3 FROM roles WHERE name = $2
+		ON CONFLICT (user_id, role_id) DO NOTHING
+	`
+	cmd, err := pool.Exec(ctx, query, userID, roleName, grantedBy)
+	if err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		exists, err := RoleExists(ctx, pool, roleName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRoleNotFound
+		}
+	}
+	return nil
+}
+
+func RemoveRole(ctx context.Context, pool *pgxpool.Pool, userID int64, roleName string) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = (SELECT id FROM roles WHERE name = $2)`
+	cmd, err := pool.Exec(ctx, query, userID, roleName)
+	if err != nil {
+		return fmt.Errorf("failed to remove role: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+// RoleExists reports whether a role with the given name is defined.
+func RoleExists(ctx context.Context, pool *pgxpool.Pool, roleName string) (bool, error) {
+	var exists bool
+	err := pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, roleName).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up role: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,188 @@
+package db
+
+import (
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// CreateSession starts a new session for the user and stores the hash of its first refresh token.
+func CreateSession(ctx context.Context, pool *pgxpool.Pool, userID int64, refreshTokenHash string, ttl time.Duration, ipAddress, userAgent string) (*models.Session, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin session transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	var s models.Session
+	query := `
+		INSERT INTO sessions (user_id, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, ip_address, user_agent, expires_at, revoked_at, last_used_at, created_at
+	`
+	err = tx.QueryRow(ctx, query, userID, ipAddress, userAgent, expiresAt).Scan(
+		&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.ExpiresAt, &s.RevokedAt, &s.LastUsedAt, &s.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`, s.ID, refreshTokenHash, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit session: %w", err)
+	}
+	return &s, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one within the same session.
+// Presenting a token that was already rotated revokes the whole session and returns ErrRefreshTokenReused.
+func RotateRefreshToken(ctx context.Context, pool *pgxpool.Pool, oldTokenHash, newTokenHash string, ttl time.Duration) (*models.Session, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin refresh transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		SELECT rt.id, rt.used_at, rt.expires_at, s.id, s.user_id, s.revoked_at
+		FROM refresh_tokens rt
+		JOIN sessions s ON rt.session_id = s.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE OF rt, s
+	`
+	var (
+		tokenID        int64
+		usedAt         *time.Time
+		tokenExpiresAt time.Time
+		sessionID      int64
+		userID         int64
+		revokedAt      *time.Time
+	)
+	err = tx.QueryRow(ctx, query, oldTokenHash).Scan(&tokenID, &usedAt, &tokenExpiresAt, &sessionID, &userID, &revokedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to revoke session after token reuse: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit session revocation: %w", err)
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if revokedAt != nil || time.Now().UTC().After(tokenExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	_, err = tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`, tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark refresh token used: %w", err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`, sessionID, newTokenHash, expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	var s models.Session
+	query = `
+		UPDATE sessions
+		SET last_used_at = NOW(), expires_at = $1
+		WHERE id = $2
+		RETURNING id, user_id, ip_address, user_agent, expires_at, revoked_at, last_used_at, created_at
+	`
+	err = tx.QueryRow(ctx, query, expiresAt, sessionID).Scan(
+		&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.ExpiresAt, &s.RevokedAt, &s.LastUsedAt, &s.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+	return &s, nil
+}
+
+// IsSessionActive reports whether the session exists, belongs to the user, and has not been revoked or expired.
+func IsSessionActive(ctx context.Context, pool *pgxpool.Pool, sessionID int64, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+		)
+	`
+	var active bool
+	err := pool.QueryRow(ctx, query, sessionID, userID).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
+
+func RevokeSession(ctx context.Context, pool *pgxpool.Pool, sessionID int64, userID int64) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	_, err := pool.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+func RevokeAllSessionsForUser(ctx context.Context, pool *pgxpool.Pool, userID int64) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	cmd, err := pool.Exec(ctx, query, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// GetActiveSessionsForUser lists sessions that have not been revoked or expired, most recently used first.
+func GetActiveSessionsForUser(ctx context.Context, pool *pgxpool.Pool, userID int64) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, ip_address, user_agent, expires_at, revoked_at, last_used_at, created_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_used_at DESC NULLS LAST
+	`
+	rows, err := pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.IPAddress, &s.UserAgent, &s.ExpiresAt, &s.RevokedAt, &s.LastUsedAt, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
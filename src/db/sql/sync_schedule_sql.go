@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetItemIDsDueForSync returns the items not synced within staleAfter, stalest first. Items waiting on the
+// user to repair them are skipped since syncing them would fail.
+func GetItemIDsDueForSync(ctx context.Context, pool *pgxpool.Pool, staleAfter time.Duration) ([]string, error) {
+	query := `
+		SELECT item_id FROM plaid_items
+		WHERE status NOT IN ('error', 'revoked')
+			AND (last_synced_at IS NULL OR last_synced_at < NOW() - make_interval(secs => $1))
+		ORDER BY last_synced_at NULLS FIRST
+	`
+	rows, err := pool.Query(ctx, query, staleAfter.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query items due for sync: %w", err)
+	}
+	defer rows.Close()
+
+	var itemIDs []string
+	for rows.Next() {
+		var itemID string
+		if err := rows.Scan(&itemID); err != nil {
+			return nil, fmt.Errorf("failed to scan item id: %w", err)
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+	return itemIDs, rows.Err()
+}
+
+// IsItemSyncDue reports whether the item still needs a sync, checked just before syncing in case another
+// instance synced it in the meantime.
+func IsItemSyncDue(ctx context.Context, pool *pgxpool.Pool, itemID int64, staleAfter time.Duration) (bool, error) {
+	query := `SELECT last_synced_at IS NULL OR last_synced_at < NOW() - make_interval(secs => $2) FROM plaid_items WHERE id = $1`
+	var due bool
+	if err := pool.QueryRow(ctx, query, itemID, staleAfter.Seconds()).Scan(&due); err != nil {
+		return false, fmt.Errorf("failed to check item %d sync state: %w", itemID, err)
+	}
+	return due, nil
+}
@@ -104,13 +104,13 @@ func ApplyTransactionRulesToUser(ctx context.Context, pool *pgxpool.Pool, userID
 		return 0, nil
 	}
 
-	// Fetch all transactions for the user (across all accounts)
+	// Fetch all transactions for the user (across all accounts), except those the user categorized by hand
 	query := `
         SELECT t.id, t.name, t.merchant_name, t.amount, a.name as account_name, t.primary_category
         FROM transactions t
         JOIN accounts a ON t.account_id = a.id
         JOIN plaid_items p ON a.item_id = p.id
-        WHERE p.user_id = $1
+        WHERE p.user_id = $1 AND NOT 'primary_category' = ANY(t.user_overridden_fields)
     `
 	rows, err := pool.Query(ctx, query, userID)
 	if err != nil {
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"budgee-server/src/db"
+	"budgee-server/src/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// Advisory lock namespace for item syncs, the second key is the plaid_items id
+const itemSyncLockClass int32 = 1
+
+// ErrItemSyncInProgress is returned when another sync of the item, in this process or any other instance, is
+// applying its changes at the same moment.
+var ErrItemSyncInProgress = errors.New("item is already being synced")
+
+// ErrSyncCursorMoved is returned when the item's cursor changed while its changes were being fetched, meaning
+// another sync already applied them.
+var ErrSyncCursorMoved = errors.New("sync cursor changed during sync")
+
+// TransactionSyncChanges is everything one /transactions/sync run returned for an item.
+type TransactionSyncChanges struct {
+	Added    []plaid.Transaction
+	Modified []plaid.Transaction
+	Removed  []plaid.RemovedTransaction
+	// PrevCursor is the cursor the run started from, NextCursor the one to store once the changes are applied
+	PrevCursor string
+	NextCursor string
+}
+
+// ApplyTransactionSync writes the added, modified and removed transactions and advances the item's cursor in a
+// single database transaction, so a failure part way through leaves both the rows and the cursor untouched.
+func ApplyTransactionSync(ctx context.Context, pool *pgxpool.Pool, itemID int64, userID int64, changes TransactionSyncChanges) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// The lock is released with the transaction, so no connection is held while Plaid is being paged through
+	var acquired bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1, $2)`, itemSyncLockClass, int32(itemID)).Scan(&acquired); err != nil {
+		return fmt.Errorf("failed to lock item %d: %w", itemID, err)
+	}
+	if !acquired {
+		return ErrItemSyncInProgress
+	}
+
+	// Lock the item row so two syncs of the same item cannot both apply the changes after the same cursor
+	var cursor string
+	err = tx.QueryRow(ctx, `SELECT COALESCE(sync_cursor, '') FROM plaid_items WHERE id = $1 FOR UPDATE`, itemID).Scan(&cursor)
+	if err != nil {
+		return fmt.Errorf("failed to lock item %d: %w", itemID, err)
+	}
+	if cursor != changes.PrevCursor {
+		return ErrSyncCursorMoved
+	}
+
+	accountTypes, err := getAccountTypes(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := saveTransactions(ctx, tx, userID, accountTypes, changes.Added); err != nil {
+		return fmt.Errorf("failed to save transactions: %w", err)
+	}
+	if err := updateTransactions(ctx, tx, userID, accountTypes, changes.Modified); err != nil {
+		return fmt.Errorf("failed to update transactions: %w", err)
+	}
+	if err := removeTransactions(ctx, tx, userID, changes.Removed); err != nil {
+		return fmt.Errorf("failed to remove transactions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE plaid_items SET sync_cursor = $1, last_synced_at = NOW() WHERE id = $2`, changes.NextCursor, itemID)
+	if err != nil {
+		return fmt.Errorf("failed to update sync cursor: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	db.ClearAllTransactionCaches()
+	return nil
+}
+
+// getAccountTypes loads the type of each of the user's accounts, keyed by Plaid account id, so the expense and
+// income flags can be worked out without a query per transaction.
+func getAccountTypes(ctx context.Context, tx pgx.Tx, userID int64) (map[string]string, error) {
+	query := `
+		SELECT a.account_id, a.type
+		FROM accounts a
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.user_id = $1
+	`
+	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account types: %w", err)
+	}
+	defer rows.Close()
+
+	accountTypes := make(map[string]string)
+	for rows.Next() {
+		var accountID, accountType string
+		if err := rows.Scan(&accountID, &accountType); err != nil {
+			return nil, fmt.Errorf("failed to scan account type: %w", err)
+		}
+		accountTypes[accountID] = accountType
+	}
+	return accountTypes, rows.Err()
+}
+
+// transactionCategories returns the personal finance categories of a Plaid transaction, or empty strings
+// when Plaid did not categorize it.
+func transactionCategories(txn plaid.Transaction) (primary, detailed, iconURL string) {
+	if txn.PersonalFinanceCategory.IsSet() {
+		primary = txn.GetPersonalFinanceCategory().Primary
+		detailed = txn.GetPersonalFinanceCategory().Detailed
+		iconURL = txn.GetPersonalFinanceCategoryIconUrl()
+	}
+	return primary, detailed, iconURL
+}
+
+// saveTransactions inserts the transactions in a single batch round trip, linking posted transactions to the
+// pending ones they replace.
+func saveTransactions(ctx context.Context, tx pgx.Tx, userID int64, accountTypes map[string]string, transactions []plaid.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO transactions (account_id, transaction_id, amount, name, date, primary_category, detailed_category, payment_channel, pending, expense, income, type, merchant_name, currency, account_owner, personal_finance_category_icon_url, pending_transaction_id, created_at)
+		SELECT a.id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $18, NOW()
+		FROM accounts a
+		JOIN plaid_items p ON a.item_id = p.id
+		WHERE p.user_id = $17 AND a.account_id = $1
+		ON CONFLICT (transaction_id) DO NOTHING
+	`
+
+	batch := &pgx.Batch{}
+	for _, txn := range transactions {
+		accountType, ok := accountTypes[txn.GetAccountId()]
+		if !ok {
+			return fmt.Errorf("unknown account %s", txn.GetAccountId())
+		}
+		primaryCategory, detailedCategory, iconURL := transactionCategories(txn)
+		expense := util.IsExpense(accountType, txn.GetAmount(), primaryCategory)
+		income := util.IsIncome(accountType, txn.GetAmount(), primaryCategory)
+
+		var pendingTransactionID *string
+		if id := txn.GetPendingTransactionId(); id != "" {
+			pendingTransactionID = &id
+		}
+
+		batch.Queue(query,
+			txn.GetAccountId(),       // $1
+			txn.GetTransactionId(),   // $2
+			txn.GetAmount(),          // $3
+			txn.GetName(),            // $4
+			txn.GetDate(),            // $5
+			primaryCategory,          // $6
+			detailedCategory,         // $7
+			txn.GetPaymentChannel(),  // $8
+			txn.GetPending(),         // $9
+			expense,                  // $10
+			income,                   // $11
+			txn.GetTransactionType(), // $12
+			txn.GetMerchantName(),    // $13
+			txn.GetIsoCurrencyCode(), // $14
+			txn.GetAccountOwner(),    // $15
+			iconURL,                  // $16
+			userID,                   // $17
+			pendingTransactionID,     // $18
+		)
+		if pendingTransactionID != nil {
+			batch.Queue(linkPendingTransactionQuery, txn.GetTransactionId(), userID)
+		}
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// linkPendingTransactionQuery copies what the user did to a pending transaction onto the posted transaction that
+// replaces it, and keeps a snapshot of the pending version. It runs before the pending row is removed later in
+// the same sync. Overridden fields keep the user's value and record the posted Plaid value in plaid_values.
+const linkPendingTransactionQuery = `
+	UPDATE transactions posted
+	SET pending_transaction = jsonb_build_object(
+			'transaction_id', pend.transaction_id,
+			'name', pend.name,
+			'merchant_name', pend.merchant_name,
+			'amount', pend.amount,
+			'date', pend.date,
+			'primary_category', pend.primary_category,
+			'created_at', pend.created_at AT TIME ZONE 'UTC'
+		),
+		user_overridden_fields = pend.user_overridden_fields,
+		plaid_values = (
+			SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb)
+			FROM jsonb_each(jsonb_build_object(
+				'amount', posted.amount,
+				'primary_category', posted.primary_category,
+				'detailed_category', posted.detailed_category,
+				'merchant_name', posted.merchant_name,
+				'date', posted.date,
+				'payment_channel', posted.payment_channel,
+				'personal_finance_category_icon_url', posted.personal_finance_category_icon_url
+			))
+			WHERE key = ANY(pend.user_overridden_fields)
+		),
+		amount = CASE WHEN 'amount' = ANY(pend.user_overridden_fields) THEN pend.amount ELSE posted.amount END,
+		date = CASE WHEN 'date' = ANY(pend.user_overridden_fields) THEN pend.date ELSE posted.date END,
+		primary_category = CASE WHEN 'primary_category' = ANY(pend.user_overridden_fields) THEN pend.primary_category ELSE posted.primary_category END,
+		detailed_category = CASE WHEN 'detailed_category' = ANY(pend.user_overridden_fields) THEN pend.detailed_category ELSE posted.detailed_category END,
+		merchant_name = CASE WHEN 'merchant_name' = ANY(pend.user_overridden_fields) THEN pend.merchant_name ELSE posted.merchant_name END,
+		payment_channel = CASE WHEN 'payment_channel' = ANY(pend.user_overridden_fields) THEN pend.payment_channel ELSE posted.payment_channel END,
+		personal_finance_category_icon_url = CASE WHEN 'personal_finance_category_icon_url' = ANY(pend.user_overridden_fields) THEN pend.personal_finance_category_icon_url ELSE posted.personal_finance_category_icon_url END,
+		expense = CASE WHEN pend.user_overridden_fields && ARRAY['amount', 'primary_category'] THEN pend.expense ELSE posted.expense END,
+		income = CASE WHEN pend.user_overridden_fields && ARRAY['amount', 'primary_category'] THEN pend.income ELSE posted.income END,
+		updated_at = NOW()
+	FROM transactions pend
+	JOIN accounts a ON pend.account_id = a.id
+	JOIN plaid_items p ON a.item_id = p.id
+	WHERE posted.transaction_id = $1
+		AND pend.transaction_id = posted.pending_transaction_id
+		AND p.user_id = $2
+		AND posted.pending_transaction IS NULL
+`
+
+// updateTransactions applies Plaid's modifications in a single batch round trip. Fields the user has overridden
+// keep their value; the new Plaid value is recorded in plaid_values instead so a reset restores the latest one.
+func updateTransactions(ctx context.Context, tx pgx.Tx, userID int64, accountTypes map[string]string, transactions []plaid.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE transactions
+		SET amount = CASE WHEN 'amount' = ANY(user_overridden_fields) THEN amount ELSE $1 END,
+			name = $2,
+			date = CASE WHEN 'date' = ANY(user_overridden_fields) THEN date ELSE $3 END,
+			primary_category = CASE WHEN 'primary_category' = ANY(user_overridden_fields) THEN primary_category ELSE $4 END,
+			detailed_category = CASE WHEN 'detailed_category' = ANY(user_overridden_fields) THEN detailed_category ELSE $5 END,
+			payment_channel = CASE WHEN 'payment_channel' = ANY(user_overridden_fields) THEN payment_channel ELSE $6 END,
+			pending = $7,
+			merchant_name = CASE WHEN 'merchant_name' = ANY(user_overridden_fields) THEN merchant_name ELSE $8 END,
+			currency = $9,
+			account_owner = $10,
+			personal_finance_category_icon_url = CASE WHEN 'personal_finance_category_icon_url' = ANY(user_overridden_fields) THEN personal_finance_category_icon_url ELSE $11 END,
+			expense = CASE WHEN user_overridden_fields && ARRAY['amount', 'primary_category'] THEN expense ELSE $12 END,
+			income = CASE WHEN user_overridden_fields && ARRAY['amount', 'primary_category'] THEN income ELSE $13 END,
+			plaid_values = (
+				SELECT COALESCE(jsonb_object_agg(key, value), '{}'::jsonb)
+				FROM jsonb_each($16::jsonb)
+				WHERE key = ANY(user_overridden_fields)
+			),
+			updated_at = NOW()
+		WHERE transaction_id = $14 AND account_id IN (
+			SELECT a.id FROM accounts a
+			JOIN plaid_items p ON a.item_id = p.id
+			WHERE p.user_id = $15
+		)
+	`
+
+	batch := &pgx.Batch{}
+	for _, txn := range transactions {
+		accountType, ok := accountTypes[txn.GetAccountId()]
+		if !ok {
+			return fmt.Errorf("unknown account %s", txn.GetAccountId())
+		}
+		primaryCategory, detailedCategory, iconURL := transactionCategories(txn)
+		expense := util.IsExpense(accountType, txn.GetAmount(), primaryCategory)
+		income := util.IsIncome(accountType, txn.GetAmount(), primaryCategory)
+
+		plaidValues, err := json.Marshal(map[string]any{
+			"amount":                             txn.GetAmount(),
+			"primary_category":                   primaryCategory,
+			"detailed_category":                  detailedCategory,
+			"merchant_name":                      txn.GetMerchantName(),
+			"date":                               txn.GetDate(),
+			"payment_channel":                    txn.GetPaymentChannel(),
+			"personal_finance_category_icon_url": iconURL,
+		})
+		if err != nil {
+			return err
+		}
+
+		batch.Queue(query,
+			txn.GetAmount(),          // $1
+			txn.GetName(),            // $2
+			txn.GetDate(),            // $3
+			primaryCategory,          // $4
+			detailedCategory,         // $5
+			txn.GetPaymentChannel(),  // $6
+			txn.GetPending(),         // $7
+			txn.GetMerchantName(),    // $8
+			txn.GetIsoCurrencyCode(), // $9
+			txn.GetAccountOwner(),    // $10
+			iconURL,                  // $11
+			expense,                  // $12
+			income,                   // $13
+			txn.GetTransactionId(),   // $14
+			userID,                   // $15
+			string(plaidValues),      // $16
+		)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
+
+// removeTransactions deletes the removed transactions with one statement.
+func removeTransactions(ctx context.Context, tx pgx.Tx, userID int64, removedTransactions []plaid.RemovedTransaction) error {
+	if len(removedTransactions) == 0 {
+		return nil
+	}
+
+	transactionIDs := make([]string, 0, len(removedTransactions))
+	for _, txn := range removedTransactions {
+		transactionIDs = append(transactionIDs, txn.GetTransactionId())
+	}
+
+	query := `
+		DELETE FROM transactions
+		WHERE transaction_id = ANY($1) AND account_id IN (
+			SELECT a.id FROM accounts a
+			JOIN plaid_items p ON a.item_id = p.id
+			WHERE p.user_id = $2
+		)
+	`
+	_, err := tx.Exec(ctx, query, transactionIDs, userID)
+	return err
+}
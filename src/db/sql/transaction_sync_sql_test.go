@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// The benchmarks compare applying a sync with batched writes against sending the same statements one round
+// trip at a time, as sync did before. They need a migrated database:
+//
+//	TEST_DATABASE_URL=postgres://... go test ./src/db/sql -run '^$' -bench TransactionSync
+
+var syncBenchmarkSizes = []int{100, 1000}
+
+// testFixture is a throwaway user with one Plaid item and one account, deleted with everything under it when
+// the test ends.
+type testFixture struct {
+	pool      *pgxpool.Pool
+	userID    int64
+	itemID    string
+	accountID string
+}
+
+// newTestFixture connects to TEST_DATABASE_URL, skipping the test when it is not set, and creates the fixture
+// with an account of the given type.
+func newTestFixture(tb testing.TB, accountType, accountSubtype string) *testFixture {
+	tb.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		tb.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		tb.Fatalf("failed to connect to test database: %v", err)
+	}
+	tb.Cleanup(pool.Close)
+
+	suffix := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	f := &testFixture{pool: pool, itemID: "item-" + suffix, accountID: "account-" + suffix}
+
+	err = pool.QueryRow(ctx, `
+		INSERT INTO users (first_name, last_name, email, username, password_hash)
+		VALUES ('Test', 'User', $1, $2, 'x')
+		RETURNING id
+	`, suffix+"@example.com", suffix).Scan(&f.userID)
+	if err != nil {
+		tb.Fatalf("failed to create user: %v", err)
+	}
+	tb.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, f.userID)
+	})
+
+	_, err = pool.Exec(ctx, `
+		WITH item AS (
+			INSERT INTO plaid_items (user_id, item_id, access_token, institution_id, status)
+			VALUES ($1, $2, $3, 'ins_test', 'active')
+			RETURNING id
+		)
+		INSERT INTO accounts (item_id, account_id, name, mask, type, subtype)
+		SELECT id, $4, 'Test account', '0000', $5, $6 FROM item
+	`, f.userID, f.itemID, "token-"+suffix, f.accountID, accountType, accountSubtype)
+	if err != nil {
+		tb.Fatalf("failed to create item and account: %v", err)
+	}
+	return f
+}
+
+// syncChanges returns n synthetic transactions that are added, then modified, then removed in the same sync
+func (f *testFixture) syncChanges(n int) TransactionSyncChanges {
+	var changes TransactionSyncChanges
+	start := time.Now().AddDate(0, 0, -n)
+	for i := 0; i < n; i++ {
+		txn := plaid.Transaction{}
+		txn.SetAccountId(f.accountID)
+		txn.SetTransactionId(fmt.Sprintf("%s-txn-%d", f.accountID, i))
+		txn.SetAmount(float64(i%200) + 0.99)
+		txn.SetName(fmt.Sprintf("Merchant %d", i%50))
+		txn.SetMerchantName(fmt.Sprintf("Merchant %d", i%50))
+		txn.SetDate(start.AddDate(0, 0, i).Format("2006-01-02"))
+		txn.SetPaymentChannel("online")
+		txn.SetTransactionType("place")
+		txn.SetIsoCurrencyCode("USD")
+		txn.SetPersonalFinanceCategory(*plaid.NewPersonalFinanceCategory("FOOD_AND_DRINK", "FOOD_AND_DRINK_RESTAURANT"))
+		changes.Added = append(changes.Added, txn)
+
+		modified := txn
+		modified.SetAmount(txn.GetAmount() + 1)
+		changes.Modified = append(changes.Modified, modified)
+
+		changes.Removed = append(changes.Removed, *plaid.NewRemovedTransaction(txn.GetTransactionId(), f.accountID))
+	}
+	return changes
+}
+
+// perRowTx is the per-row baseline. It runs the production write functions but sends each statement they
+// batch in its own round trip, the way sync wrote transactions before it was batched.
+type perRowTx struct {
+	pgx.Tx
+}
+
+func (tx perRowTx) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults {
+	for _, q := range b.QueuedQueries {
+		if _, err := tx.Tx.Exec(ctx, q.SQL, q.Arguments...); err != nil {
+			return perRowResults{err: err}
+		}
+	}
+	return perRowResults{}
+}
+
+// perRowResults only supports Close, the one method the write functions call
+type perRowResults struct {
+	pgx.BatchResults
+	err error
+}
+
+func (r perRowResults) Close() error {
+	return r.err
+}
+
+// benchmarkTransactionSync applies n changes b.N times, each in a transaction that is rolled back
+func benchmarkTransactionSync(b *testing.B, wrap func(pgx.Tx) pgx.Tx) {
+	f := newTestFixture(b, "depository", "checking")
+	for _, n := range syncBenchmarkSizes {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			changes := f.syncChanges(n)
+			ctx := context.Background()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tx, err := f.pool.Begin(ctx)
+				if err != nil {
+					b.Fatalf("failed to begin transaction: %v", err)
+				}
+				if err := applySyncChanges(ctx, wrap(tx), f.userID, changes); err != nil {
+					tx.Rollback(ctx)
+					b.Fatalf("failed to apply changes: %v", err)
+				}
+				tx.Rollback(ctx)
+			}
+		})
+	}
+}
+
+func applySyncChanges(ctx context.Context, tx pgx.Tx, userID int64, changes TransactionSyncChanges) error {
+	accountTypes, err := getAccountTypes(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if err := saveTransactions(ctx, tx, userID, accountTypes, changes.Added); err != nil {
+		return err
+	}
+	if err := updateTransactions(ctx, tx, userID, accountTypes, changes.Modified); err != nil {
+		return err
+	}
+	return removeTransactions(ctx, tx, userID, changes.Removed)
+}
+
+func BenchmarkTransactionSyncPerRow(b *testing.B) {
+	benchmarkTransactionSync(b, func(tx pgx.Tx) pgx.Tx { return perRowTx{tx} })
+}
+
+func BenchmarkTransactionSyncBatch(b *testing.B) {
+	benchmarkTransactionSync(b, func(tx pgx.Tx) pgx.Tx { return tx })
+}
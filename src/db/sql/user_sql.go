@@ -14,7 +14,7 @@ import (
 func GetUserByID(id int, pool *pgxpool.Pool) (*models.User, error) {
 	var user models.User
 	query := `
-		SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked
+		SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked, locked_until, totp_enabled, totp_secret, email_verified_at, pending_email, deletion_scheduled_for
 		FROM users 
 		WHERE id = $1
 	`
@@ -30,6 +30,12 @@ func GetUserByID(id int, pool *pgxpool.Pool) (*models.User, error) {
 		&user.SuperAdmin,
 		&user.LastLogin,
 		&user.Locked,
+		&user.LockedUntil,
+		&user.TOTPEnabled,
+		&user.TOTPSecret,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledFor,
 	)
 
 	if err != nil {
@@ -41,7 +47,7 @@ func GetUserByID(id int, pool *pgxpool.Pool) (*models.User, error) {
 func GetUserByUsername(username string, pool *pgxpool.Pool) (*models.User, error) {
 	var user models.User
 	query := `
-        SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked
+        SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked, locked_until, totp_enabled, totp_secret, email_verified_at, pending_email, deletion_scheduled_for
         FROM users 
         WHERE username = $1
     `
@@ -57,6 +63,12 @@ func GetUserByUsername(username string, pool *pgxpool.Pool) (*models.User, error
 		&user.SuperAdmin,
 		&user.LastLogin,
 		&user.Locked,
+		&user.LockedUntil,
+		&user.TOTPEnabled,
+		&user.TOTPSecret,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledFor,
 	)
 
 	if err != nil {
@@ -71,7 +83,7 @@ func GetUserByUsername(username string, pool *pgxpool.Pool) (*models.User, error
 func GetUserByEmail(email string, pool *pgxpool.Pool) (*models.User, error) {
 	var user models.User
 	query := `
-        SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked
+        SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked, locked_until, totp_enabled, totp_secret, email_verified_at, pending_email, deletion_scheduled_for
         FROM users 
         WHERE email = $1
     `
@@ -87,6 +99,12 @@ func GetUserByEmail(email string, pool *pgxpool.Pool) (*models.User, error) {
 		&user.SuperAdmin,
 		&user.LastLogin,
 		&user.Locked,
+		&user.LockedUntil,
+		&user.TOTPEnabled,
+		&user.TOTPSecret,
+		&user.EmailVerifiedAt,
+		&user.PendingEmail,
+		&user.DeletionScheduledFor,
 	)
 
 	if err != nil {
@@ -98,43 +116,6 @@ func GetUserByEmail(email string, pool *pgxpool.Pool) (*models.User, error) {
 	return &user, nil
 }
 
-func CreateUser(req models.RegisterRequest, hashedPassword string, pool *pgxpool.Pool) (*models.RegisterResponse, error) {
-	query := `
-		INSERT INTO users (first_name, last_name, username, email, password_hash, last_login)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, super_admin
-	`
-
-	var userID int
-	var superAdmin bool
-
-	now := time.Now().UTC()
-
-	err := pool.QueryRow(
-		context.Background(),
-		query,
-		req.FirstName,
-		req.LastName,
-		req.Username,
-		req.Email,
-		hashedPassword,
-		now,
-	).Scan(&userID, &superAdmin)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
-	}
-
-	resp := models.RegisterResponse{
-		ID:         userID,
-		Email:      req.Email,
-		Username:   req.Username,
-		SuperAdmin: superAdmin,
-	}
-
-	return &resp, nil
-}
-
 func UpdateUserLastLogin(pool *pgxpool.Pool, userID int64) error {
 	query := `
 		UPDATE users
@@ -150,25 +131,10 @@ func UpdateUserLastLogin(pool *pgxpool.Pool, userID int64) error {
 
 func DeleteUser(userID int, pool *pgxpool.Pool) error {
 	query := `
-		SELECT email FROM users
-		WHERE id = $1;
-	`
-	var email string
-	err := pool.QueryRow(
-		context.Background(),
-		query,
-		userID,
-	).Scan(&email)
-
-	if err != nil {
-		return fmt.Errorf("failed to get user email when deleting user: %w", err)
-	}
-
-	query = `
 		DELETE FROM users
 		WHERE id = $1;
 	`
-	_, err = pool.Exec(
+	cmd, err := pool.Exec(
 		context.Background(),
 		query,
 		userID,
@@ -177,21 +143,11 @@ func DeleteUser(userID int, pool *pgxpool.Pool) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
-
-	query = `
-		DELETE FROM whitelisted_emails
-		WHERE email = $1;	
-	`
-	_, err = pool.Exec(
-		context.Background(),
-		query,
-		email,
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to delete associated whitelisted user email: %w", err)
+	if cmd.RowsAffected() == 0 {
+		return fmt.Errorf("failed to delete user: user not found")
 	}
 
+	// The user's invitation stays marked as redeemed, so the email cannot register again without a new invitation
 	return nil
 }
 
@@ -223,7 +179,7 @@ func UpdateUserPassword(ctx context.Context, pool *pgxpool.Pool, userID int64, h
 
 func GetAllUsers(pool *pgxpool.Pool) ([]models.User, error) {
 	query := `
-		SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked
+		SELECT id, username, email, first_name, last_name, password_hash, created_at, theme, super_admin, last_login, locked, locked_until, totp_enabled, totp_secret, email_verified_at, pending_email, deletion_scheduled_for
 		FROM users
 		ORDER BY id
 	`
@@ -248,6 +204,12 @@ func GetAllUsers(pool *pgxpool.Pool) ([]models.User, error) {
 			&user.SuperAdmin,
 			&user.LastLogin,
 			&user.Locked,
+			&user.LockedUntil,
+			&user.TOTPEnabled,
+			&user.TOTPSecret,
+			&user.EmailVerifiedAt,
+			&user.PendingEmail,
+			&user.DeletionScheduledFor,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
@@ -261,7 +223,7 @@ func GetAllUsers(pool *pgxpool.Pool) ([]models.User, error) {
 }
 
 func LockUser(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
-	query := `UPDATE users SET locked = TRUE, updated_at = NOW() WHERE id = $1`
+	query := `UPDATE users SET locked = TRUE, locked_until = NULL, updated_at = NOW() WHERE id = $1`
 	_, err := pool.Exec(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to lock user: %w", err)
@@ -270,10 +232,21 @@ func LockUser(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
 }
 
 func UnlockUser(ctx context.Context, pool *pgxpool.Pool, userID int64) error {
-	query := `UPDATE users SET locked = FALSE, updated_at = NOW() WHERE id = $1`
+	query := `UPDATE users SET locked = FALSE, locked_until = NULL, updated_at = NOW() WHERE id = $1`
 	_, err := pool.Exec(ctx, query, userID)
 	if err != nil {
 		return fmt.Errorf("failed to unlock user: %w", err)
 	}
 	return nil
 }
+
+// LockUserUntil places an automatic lockout that expires at lockedUntil. Users who are already locked, for
+// instance indefinitely by an admin, are left alone; it returns false for them.
+func LockUserUntil(ctx context.Context, pool *pgxpool.Pool, userID int64, lockedUntil time.Time) (bool, error) {
+	query := `UPDATE users SET locked = TRUE, locked_until = $1, updated_at = NOW() WHERE id = $2 AND locked = FALSE`
+	cmd, err := pool.Exec(ctx, query, lockedUntil, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock user: %w", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// DeleteUser schedules the caller's account for deletion after the grace period. Until then the user can
+// still sign in and cancel it.
+func DeleteUser(pool *pgxpool.Pool, mail mailer.Mailer, gracePeriod time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		log.Printf("INFO: DeleteUser called for user_id: %d", userID)
+
+		// Security: Only allow user to delete themselves
+		var req struct {
+			UserID int64 `json:"user_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode delete user request body for user_id: %d: %v", userID, err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.UserID != userID {
+			log.Printf("ERROR: Forbidden delete attempt - Authenticated user: %d, Requested user: %d", userID, req.UserID)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user %d for deletion: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		scheduledFor, err := db.ScheduleUserDeletion(r.Context(), pool, userID, time.Now().UTC().Add(gracePeriod))
+		if err != nil {
+			log.Printf("ERROR: Failed to schedule deletion for user %d: %v", userID, err)
+			http.Error(w, "failed to delete user", http.StatusInternalServerError)
+			return
+		}
+
+		body := fmt.Sprintf(
+			"Hi %s,\n\nYour Budgee account and all of its data will be permanently deleted on %s.\n\nIf you change your mind, sign in before then and cancel the deletion from your account settings.\n",
+			user.FirstName, scheduledFor.Format("January 2, 2006"),
+		)
+		go func(to string) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := mail.Send(ctx, to, "Your Budgee account is scheduled for deletion", body); err != nil {
+				log.Printf("ERROR: Failed to send deletion notice to user %d: %v", userID, err)
+			}
+		}(user.Email)
+
+		log.Printf("INFO: User %d scheduled for deletion at %s", userID, scheduledFor.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":                "account deletion scheduled",
+			"deletion_scheduled_for": scheduledFor,
+		})
+	}
+}
+
+func CancelAccountDeletion(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		err := db.CancelUserDeletion(r.Context(), pool, userID)
+		if err != nil {
+			if errors.Is(err, db.ErrNoDeletionScheduled) {
+				http.Error(w, "no account deletion is scheduled", http.StatusBadRequest)
+				return
+			}
+			log.Printf("ERROR: Failed to cancel deletion for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: User %d cancelled their account deletion", userID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "account deletion cancelled",
+		})
+	}
+}
+
+// purgeUser removes every linked item from Plaid before deleting the user and, through the cascade, all of
+// their data. Items Plaid no longer knows about are skipped, any other failure leaves the user in place.
+func purgeUser(ctx context.Context, plaidClient *plaid.APIClient, pool *pgxpool.Pool, userID int64) error {
+	items, err := db.GetPlaidItemsSQL(ctx, pool, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get plaid items: %w", err)
+	}
+
+	for _, item := range items {
+		request := plaid.NewItemRemoveRequest(item.AccessToken)
+		_, _, err := plaidClient.PlaidApi.ItemRemove(ctx).ItemRemoveRequest(*request).Execute()
+		if err != nil {
+			plaidErr, convErr := plaid.ToPlaidError(err)
+			if convErr == nil && (plaidErr.ErrorCode == "ITEM_NOT_FOUND" || plaidErr.ErrorCode == "INVALID_ACCESS_TOKEN") {
+				log.Printf("INFO: Plaid item %s already removed for user %d", item.ItemID, userID)
+				continue
+			}
+			return fmt.Errorf("failed to remove plaid item %s: %w", item.ItemID, err)
+		}
+		log.Printf("INFO: Plaid item removed - User: %d, Item: %s", userID, item.ItemID)
+	}
+
+	if err := db.DeleteUser(int(userID), pool); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RunScheduledAccountDeletions purges accounts whose deletion grace period has passed, checking every interval
+// until ctx is done. A user whose purge fails is retried on the next run.
+func RunScheduledAccountDeletions(ctx context.Context, plaidClient *plaid.APIClient, pool *pgxpool.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runScheduledAccountDeletions(ctx, plaidClient, pool)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runScheduledAccountDeletions purges the users that are due. Every instance runs the loop, so the run holds an
+// advisory lock and is skipped while another instance is purging.
+func runScheduledAccountDeletions(ctx context.Context, plaidClient *plaid.APIClient, pool *pgxpool.Pool) {
+	release, acquired, err := db.TryLockAccountDeletions(ctx, pool)
+	if err != nil {
+		log.Printf("ERROR: Failed to lock scheduled account deletions: %v", err)
+		return
+	}
+	if !acquired {
+		log.Printf("INFO: Scheduled account deletions are running on another instance, skipping")
+		return
+	}
+	defer release()
+
+	userIDs, err := db.GetUsersDueForDeletion(ctx, pool)
+	if err != nil {
+		log.Printf("ERROR: Failed to get users due for deletion: %v", err)
+		return
+	}
+	for _, userID := range userIDs {
+		if err := purgeUser(ctx, plaidClient, pool, userID); err != nil {
+			log.Printf("ERROR: Failed to purge user %d, will retry: %v", userID, err)
+			continue
+		}
+		log.Printf("INFO: User %d deleted after grace period", userID)
+	}
+}
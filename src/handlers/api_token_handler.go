@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultAPITokenTTLDays = 90
+	maxAPITokenTTLDays     = 365
+)
+
+func CreateAPIToken(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		var req struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays *int     `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode create api token request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 100 {
+			http.Error(w, "name is required and must be at most 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Scopes) == 0 {
+			http.Error(w, "at least one scope is required", http.StatusBadRequest)
+			return
+		}
+		var scopes []string
+		for _, scope := range req.Scopes {
+			if !slices.Contains(models.APITokenScopes, scope) {
+				http.Error(w, "invalid scope: "+scope, http.StatusBadRequest)
+				return
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		days := defaultAPITokenTTLDays
+		if req.ExpiresInDays != nil {
+			if *req.ExpiresInDays <= 0 || *req.ExpiresInDays > maxAPITokenTTLDays {
+				http.Error(w, "expires_in_days must be between 1 and "+strconv.Itoa(maxAPITokenTTLDays), http.StatusBadRequest)
+				return
+			}
+			days = *req.ExpiresInDays
+		}
+
+		secret, err := util.GenerateRandomToken(32)
+		if err != nil {
+			log.Printf("ERROR: Failed to generate api token: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		rawToken := util.APITokenPrefix + secret
+
+		token, err := db.CreateAPIToken(r.Context(), pool, userID, req.Name, util.HashToken(rawToken), scopes, time.Now().UTC().AddDate(0, 0, days))
+		if err != nil {
+			log.Printf("ERROR: Failed to create api token for user %d: %v", userID, err)
+			http.Error(w, "failed to create", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: API token created - ID: %d, User: %d, Scopes: %v", token.ID, userID, scopes)
+
+		// The token is only ever returned here; the database keeps just its hash
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"api_token": token,
+			"token":     rawToken,
+		})
+	}
+}
+
+func GetAPITokens(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		tokens, err := db.GetAPITokensForUser(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get api tokens for user %d: %v", userID, err)
+			http.Error(w, "failed to get api tokens", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	}
+}
+
+func RevokeAPIToken(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		idStr := chi.URLParam(r, "token_id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Invalid api token id param for revoke: %s", idStr)
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		err = db.RevokeAPIToken(r.Context(), pool, id, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to revoke api token id %d for user %d: %v", id, userID, err)
+			http.Error(w, "api token not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("INFO: API token revoked - ID: %d, User: %d", id, userID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// GetAuditEvents lists audit events newest first. Supported filters: actor_user_id, action (substring),
+// target_type, target_id, from and to (RFC 3339), plus page and page_size for pagination.
+func GetAuditEvents(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := models.AuditEventFilter{
+			Action:     q.Get("action"),
+			TargetType: q.Get("target_type"),
+			TargetID:   q.Get("target_id"),
+			Limit:      defaultAuditPageSize,
+		}
+
+		if v := q.Get("actor_user_id"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid actor_user_id", http.StatusBadRequest)
+				return
+			}
+			filter.ActorUserID = id
+		}
+		for _, bound := range []struct {
+			name string
+			dest **time.Time
+		}{{"from", &filter.From}, {"to", &filter.To}} {
+			if v := q.Get(bound.name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, "invalid "+bound.name+", expected RFC 3339", http.StatusBadRequest)
+					return
+				}
+				*bound.dest = &t
+			}
+		}
+
+		page := 1
+		if v := q.Get("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid page", http.StatusBadRequest)
+				return
+			}
+			page = n
+		}
+		if v := q.Get("page_size"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxAuditPageSize {
+				http.Error(w, "page_size must be between 1 and "+strconv.Itoa(maxAuditPageSize), http.StatusBadRequest)
+				return
+			}
+			filter.Limit = n
+		}
+		filter.Offset = (page - 1) * filter.Limit
+
+		events, total, err := db.GetAuditEvents(r.Context(), pool, filter)
+		if err != nil {
+			log.Printf("ERROR: Failed to get audit events: %v", err)
+			http.Error(w, "failed to get audit events", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"events":    events,
+			"total":     total,
+			"page":      page,
+			"page_size": filter.Limit,
+		})
+	}
+}
+
+// auditUserSnapshot captures the fields of a user worth keeping in the audit log, leaving out credentials.
+func auditUserSnapshot(user *models.User) map[string]interface{} {
+	if user == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"id":           user.ID,
+		"username":     user.Username,
+		"email":        user.Email,
+		"first_name":   user.FirstName,
+		"last_name":    user.LastName,
+		"super_admin":  user.SuperAdmin,
+		"locked":       user.Locked,
+		"locked_until": user.LockedUntil,
+		"totp_enabled": user.TOTPEnabled,
+	}
+}
@@ -1,22 +1,32 @@
 package handlers
 
 import (
+	"budgee-server/src/config"
 	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
 	"budgee-server/src/models"
 	"budgee-server/src/util"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Register(pool *pgxpool.Pool) http.HandlerFunc {
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	mfaPendingTokenTTL = 5 * time.Minute
+)
+
+func Register(pool *pgxpool.Pool, mail mailer.Mailer, appBaseURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req models.RegisterRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -27,26 +37,7 @@ func Register(pool *pgxpool.Pool) http.HandlerFunc {
 
 		req.Email = strings.TrimSpace(req.Email)
 		req.Username = strings.TrimSpace(req.Username)
-
-		// Whitelist check using whitelisted_emails table
-		whitelist, err := db.GetAllWhitelistedEmails(r.Context(), pool)
-		if err != nil {
-			log.Printf("ERROR: Failed to fetch whitelisted emails: %v", err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
-		}
-		emailAllowed := false
-		for _, entry := range whitelist {
-			if strings.EqualFold(strings.TrimSpace(entry.Email), req.Email) {
-				emailAllowed = true
-				break
-			}
-		}
-		if !emailAllowed {
-			log.Printf("ERROR: Registration denied for non-whitelisted email: %s", req.Email)
-			http.Error(w, "registration is restricted to invited emails", http.StatusForbidden)
-			return
-		}
+		req.InviteCode = strings.TrimSpace(req.InviteCode)
 
 		if !util.ValidateEmail(req.Email) {
 			log.Printf("ERROR: Email validation failed during registration - Email: %s", req.Email)
@@ -73,9 +64,20 @@ func Register(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		codeHash := ""
+		if req.InviteCode != "" {
+			codeHash = util.HashToken(req.InviteCode)
+		}
+
+		// The invitation is checked and consumed in the same transaction that creates the user
 		var resp *models.RegisterResponse
-		resp, err = db.CreateUser(req, string(hashedPassword), pool)
+		resp, err = db.RegisterWithInvitation(r.Context(), pool, req, string(hashedPassword), codeHash)
 		if err != nil {
+			if errors.Is(err, db.ErrInvitationInvalid) {
+				log.Printf("ERROR: Registration denied without a valid invitation - Email: %s", req.Email)
+				http.Error(w, "registration is restricted to invited emails", http.StatusForbidden)
+				return
+			}
 			// Handle duplicate key
 			if strings.Contains(err.Error(), "duplicate key") {
 				log.Printf("ERROR: Registration failed - email or username already exists - Email: %s, Username: %s", req.Email, req.Username)
@@ -89,30 +91,26 @@ func Register(pool *pgxpool.Pool) http.HandlerFunc {
 
 		log.Printf("INFO: Successful registration - User: %s, ID: %d", resp.Username, resp.ID)
 
-		// Generate JWT token for the new user
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id":     resp.ID,
-			"username":    resp.Username,
-			"super_admin": resp.SuperAdmin,
-			"exp":         time.Now().Add(time.Hour * 168).Unix(),
-		})
+		// The account stays limited until the address is confirmed
+		if err := sendEmailVerification(mail, appBaseURL, int64(resp.ID), req.FirstName, req.Email, false); err != nil {
+			log.Printf("ERROR: Failed to issue email verification for user %d: %v", resp.ID, err)
+		}
 
-		tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+		// Start a session for the new user
+		accessToken, refreshToken, err := createSessionTokens(r, pool, int64(resp.ID), resp.Username, resp.SuperAdmin)
 		if err != nil {
-			log.Printf("ERROR: Failed to generate JWT token for user %s: %v", resp.Username, err)
+			log.Printf("ERROR: Failed to create session for user %s: %v", resp.Username, err)
 			http.Error(w, "Error generating token", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{
-			"token": tokenString,
-		})
+		json.NewEncoder(w).Encode(tokenResponse(accessToken, refreshToken))
 	}
 }
 
-func Login(pool *pgxpool.Pool) http.HandlerFunc {
+func Login(pool *pgxpool.Pool, throttle config.LoginThrottleConfig, mail mailer.Mailer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		enableCors(&w)
 
@@ -127,46 +125,91 @@ func Login(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		ipAddress := util.ClientIP(r)
+
+		// Back off clients that keep failing, regardless of which account they target
+		ipFailures, err := db.GetIPLoginFailure(r.Context(), pool, ipAddress)
+		if err != nil {
+			log.Printf("ERROR: Failed to get login failures for IP %s: %v", ipAddress, err)
+		}
+		if wait := loginRetryAfter(ipFailures, throttle, time.Now().UTC()); wait > 0 {
+			log.Printf("ERROR: Login throttled for IP %s, retry after %s", ipAddress, wait)
+			recordLoginFailure(r, pool, nil, credentials.UsernameOrEmail, "throttled")
+			writeTooManyAttempts(w, wait)
+			return
+		}
+
 		user, err := db.GetUserByUsername(strings.ToLower(credentials.UsernameOrEmail), pool)
 		if err != nil {
 			user, err = db.GetUserByEmail(strings.ToLower(credentials.UsernameOrEmail), pool)
 
 			if err != nil {
 				log.Printf("ERROR: Failed to find user during login - Username/Email: %s: %v", credentials.UsernameOrEmail, err)
+				recordFailedLogin(r, pool, throttle, nil, ipAddress)
+				recordLoginFailure(r, pool, nil, credentials.UsernameOrEmail, "unknown_user")
 				http.Error(w, "User not found", http.StatusUnauthorized)
 				return
 			}
 		}
 
+		unlockIfLockoutExpired(r, pool, user)
+
 		if user.Locked {
 			log.Printf("ERROR: Locked user attempted login - Username/Email: %s", credentials.UsernameOrEmail)
+			recordLoginFailure(r, pool, user, credentials.UsernameOrEmail, "locked")
 			http.Error(w, "User account is locked", http.StatusForbidden)
 			return
 		}
 
+		userFailures, err := db.GetUserLoginFailure(r.Context(), pool, user.ID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get login failures for user %d: %v", user.ID, err)
+		}
+		if wait := loginRetryAfter(userFailures, throttle, time.Now().UTC()); wait > 0 {
+			log.Printf("ERROR: Login throttled for user %s, retry after %s", user.Username, wait)
+			recordLoginFailure(r, pool, user, credentials.UsernameOrEmail, "throttled")
+			writeTooManyAttempts(w, wait)
+			return
+		}
+
 		if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(credentials.Password)); err != nil {
 			log.Printf("ERROR: Invalid password attempt for username/email %s from IP %s",
-				credentials.UsernameOrEmail, r.RemoteAddr)
+				credentials.UsernameOrEmail, ipAddress)
+			recordFailedLogin(r, pool, throttle, user, ipAddress)
+			recordLoginFailure(r, pool, user, credentials.UsernameOrEmail, "invalid_password")
 			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 			return
 		}
 
-		// Create the JWT token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id":     user.ID,
-			"username":    user.Username,
-			"super_admin": user.SuperAdmin,
-			"exp":         time.Now().Add(time.Hour * 168).Unix(),
-		})
+		// Users with two-factor authentication finish logging in at /api/login/mfa
+		if user.TOTPEnabled {
+			mfaToken, err := generateMFAPendingToken(user.ID, nil)
+			if err != nil {
+				log.Printf("ERROR: Failed to generate MFA token for user %s: %v", user.Username, err)
+				http.Error(w, "Error generating token", http.StatusInternalServerError)
+				return
+			}
+
+			log.Printf("INFO: Password accepted, awaiting second factor - User: %s, ID: %d", user.Username, user.ID)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"mfa_required": true,
+				"mfa_token":    mfaToken,
+			})
+			return
+		}
 
-		tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+		accessToken, refreshToken, err := createSessionTokens(r, pool, user.ID, user.Username, user.SuperAdmin)
 		if err != nil {
-			log.Printf("ERROR: Failed to generate JWT token for user %s: %v",
+			log.Printf("ERROR: Failed to create session for user %s: %v",
 				user.Username, err)
 			http.Error(w, "Error generating token", http.StatusInternalServerError)
 			return
 		}
 
+		clearLoginFailures(r, pool, user.ID, ipAddress)
+		recordLoginSuccess(r, pool, mail, user)
+
 		err = db.UpdateUserLastLogin(pool, user.ID)
 		if err != nil {
 			log.Printf("ERROR: Failed to update last_login for user %s: %v", user.Username, err)
@@ -175,12 +218,197 @@ func Login(pool *pgxpool.Pool) http.HandlerFunc {
 		log.Printf("INFO: Successful login - User: %s, ID: %d", user.Username, user.ID)
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"token": tokenString,
+		json.NewEncoder(w).Encode(tokenResponse(accessToken, refreshToken))
+	}
+}
+
+func RefreshToken(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			log.Printf("ERROR: Failed to decode refresh token request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		newRefreshToken, err := util.GenerateRandomToken(32)
+		if err != nil {
+			log.Printf("ERROR: Failed to generate refresh token: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		session, err := db.RotateRefreshToken(r.Context(), pool, util.HashToken(req.RefreshToken), util.HashToken(newRefreshToken), refreshTokenTTL)
+		if err != nil {
+			if errors.Is(err, db.ErrRefreshTokenReused) {
+				log.Printf("ERROR: Refresh token reuse detected from IP %s, session revoked", util.ClientIP(r))
+				http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, db.ErrInvalidRefreshToken) {
+				log.Printf("ERROR: Invalid or expired refresh token presented from IP %s", util.ClientIP(r))
+				http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+				return
+			}
+			log.Printf("ERROR: Failed to rotate refresh token: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		user, err := db.GetUserByID(int(session.UserID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user for token refresh - user_id: %d: %v", session.UserID, err)
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+
+		if user.Locked {
+			if err := db.RevokeSession(r.Context(), pool, session.ID, user.ID); err != nil {
+				log.Printf("ERROR: Failed to revoke session %d for locked user %d: %v", session.ID, user.ID, err)
+			}
+			log.Printf("ERROR: Locked user attempted token refresh - User: %d", user.ID)
+			http.Error(w, "User account is locked", http.StatusForbidden)
+			return
+		}
+
+		accessToken, err := generateAccessToken(user.ID, user.Username, user.SuperAdmin, session.ID)
+		if err != nil {
+			log.Printf("ERROR: Failed to generate JWT token for user %s: %v", user.Username, err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokenResponse(accessToken, newRefreshToken))
+	}
+}
+
+func Logout(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+		sessionID := r.Context().Value("session_id").(int64)
+
+		err := db.RevokeSession(r.Context(), pool, sessionID, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to revoke session %d for user %d: %v", sessionID, userID, err)
+			http.Error(w, "failed to log out", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: User %d logged out of session %d", userID, sessionID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "logged out"})
+	}
+}
+
+func LogoutAll(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		revoked, err := db.RevokeAllSessionsForUser(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to revoke all sessions for user %d: %v", userID, err)
+			http.Error(w, "failed to log out", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: User %d logged out everywhere, %d sessions revoked", userID, revoked)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":          "logged out of all sessions",
+			"sessions_revoked": revoked,
 		})
 	}
 }
 
+// createSessionTokens opens a new server-side session and returns a short-lived access token
+// bound to it, along with the session's first refresh token.
+func createSessionTokens(r *http.Request, pool *pgxpool.Pool, userID int64, username string, superAdmin bool) (string, string, error) {
+	refreshToken, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	session, err := db.CreateSession(r.Context(), pool, userID, util.HashToken(refreshToken), refreshTokenTTL, util.ClientIP(r), r.UserAgent())
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := generateAccessToken(userID, username, superAdmin, session.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+func generateAccessToken(userID int64, username string, superAdmin bool, sessionID int64) (string, error) {
+	return util.SignJWT(jwt.MapClaims{
+		"user_id":     userID,
+		"username":    username,
+		"super_admin": superAdmin,
+		"sid":         sessionID,
+		"exp":         time.Now().Add(accessTokenTTL).Unix(),
+	})
+}
+
+// generateMFAPendingToken issues a short-lived token proving the password step succeeded.
+// It carries no session, so JWTAuthMiddleware rejects it everywhere except /api/login/mfa.
+// For an OIDC login it also carries the identity to link once the second factor is verified.
+func generateMFAPendingToken(userID int64, identity *oidcIdentity) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":     userID,
+		"mfa_pending": true,
+		"exp":         time.Now().Add(mfaPendingTokenTTL).Unix(),
+	}
+	if identity != nil {
+		claims["oidc_provider"] = identity.Provider
+		claims["oidc_subject"] = identity.Subject
+		claims["oidc_email"] = identity.Email
+	}
+	return util.SignJWT(claims)
+}
+
+func parseMFAPendingToken(tokenString string) (int64, *oidcIdentity, error) {
+	claims, err := util.ParseJWT(tokenString)
+	if err != nil {
+		return 0, nil, err
+	}
+	if pending, _ := claims["mfa_pending"].(bool); !pending {
+		return 0, nil, fmt.Errorf("not an mfa token")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, nil, fmt.Errorf("invalid token claims")
+	}
+
+	var identity *oidcIdentity
+	if provider, _ := claims["oidc_provider"].(string); provider != "" {
+		subject, _ := claims["oidc_subject"].(string)
+		email, _ := claims["oidc_email"].(string)
+		identity = &oidcIdentity{Provider: provider, Subject: subject, Email: email}
+	}
+	return int64(userID), identity, nil
+}
+
+// GetJWKS publishes the public keys that access tokens can be verified with.
+func GetJWKS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(util.JWKS())
+	}
+}
+
+func tokenResponse(accessToken, refreshToken string) map[string]interface{} {
+	return map[string]interface{}{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL.Seconds()),
+	}
+}
+
 func enableCors(w *http.ResponseWriter) {
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
 }
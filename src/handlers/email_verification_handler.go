@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
+	"budgee-server/src/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	emailVerificationTTL     = 24 * time.Hour
+	emailVerificationPurpose = "email_verification"
+)
+
+// generateEmailVerificationToken signs a link token bound to the user and the exact address being confirmed,
+// so a link stops working once the account's email or pending email changes.
+func generateEmailVerificationToken(userID int64, email string) (string, error) {
+	return util.SignJWT(jwt.MapClaims{
+		"user_id": userID,
+		"email":   email,
+		"purpose": emailVerificationPurpose,
+		"exp":     time.Now().Add(emailVerificationTTL).Unix(),
+	})
+}
+
+func parseEmailVerificationToken(tokenString string) (int64, string, error) {
+	claims, err := util.ParseJWT(tokenString)
+	if err != nil {
+		return 0, "", err
+	}
+	if purpose, _ := claims["purpose"].(string); purpose != emailVerificationPurpose {
+		return 0, "", fmt.Errorf("not an email verification token")
+	}
+	userID, ok := claims["user_id"].(float64)
+	email, ok2 := claims["email"].(string)
+	if !ok || !ok2 {
+		return 0, "", fmt.Errorf("invalid token claims")
+	}
+	return int64(userID), email, nil
+}
+
+// sendEmailVerification mails a verification link for the given address. An email change sends the link to
+// the new address, which only becomes the account's email once it is followed.
+func sendEmailVerification(mail mailer.Mailer, appBaseURL string, userID int64, firstName, to string, emailChange bool) error {
+	token, err := generateEmailVerificationToken(userID, to)
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(appBaseURL, "/") + "/verify-email?token=" + url.QueryEscape(token)
+	subject := "Verify your Budgee email"
+	body := fmt.Sprintf(
+		"Hi %s,\n\nPlease confirm this is your email address by following the link below within the next 24 hours:\n\n%s\n\nIf you did not create a Budgee account, you can ignore this email.\n",
+		firstName, link,
+	)
+	if emailChange {
+		subject = "Confirm your new Budgee email"
+		body = fmt.Sprintf(
+			"Hi %s,\n\nWe received a request to change your Budgee email to this address. Follow the link below within the next 24 hours to confirm the change:\n\n%s\n\nIf you did not request this, you can ignore this email and your account will keep its current address.\n",
+			firstName, link,
+		)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mail.Send(ctx, to, subject, body); err != nil {
+			log.Printf("ERROR: Failed to send email verification to user %d: %v", userID, err)
+		}
+	}()
+	return nil
+}
+
+// VerifyEmail confirms the address a verification link was sent to, either the account's current email
+// or a pending email change.
+func VerifyEmail(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+			log.Printf("ERROR: Failed to decode verify email request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, email, err := parseEmailVerificationToken(req.Token)
+		if err != nil {
+			log.Printf("ERROR: Invalid email verification token presented from IP %s: %v", util.ClientIP(r), err)
+			http.Error(w, "invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Email verification for unknown user %d", userID)
+			http.Error(w, "invalid or expired verification link", http.StatusBadRequest)
+			return
+		}
+
+		message := "email verified"
+		if user.PendingEmail != nil && *user.PendingEmail == email {
+			err = db.ConfirmPendingEmail(r.Context(), pool, userID, email)
+			message = "email changed"
+		} else {
+			err = db.MarkEmailVerified(r.Context(), pool, userID, email)
+		}
+		if err != nil {
+			if errors.Is(err, db.ErrEmailVerificationStale) {
+				log.Printf("ERROR: Stale email verification link used for user %d", userID)
+				http.Error(w, "invalid or expired verification link", http.StatusBadRequest)
+				return
+			}
+			if errors.Is(err, db.ErrEmailInUse) {
+				log.Printf("ERROR: Email change for user %d conflicts with an existing account", userID)
+				http.Error(w, "email is already in use", http.StatusConflict)
+				return
+			}
+			log.Printf("ERROR: Failed to verify email for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Email verified - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": message,
+		})
+	}
+}
+
+// ResendEmailVerification sends a fresh link for the pending email change, or for the current email
+// while it is unverified.
+func ResendEmailVerification(pool *pgxpool.Pool, mail mailer.Mailer, appBaseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user %d for email verification: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case user.PendingEmail != nil:
+			err = sendEmailVerification(mail, appBaseURL, userID, user.FirstName, *user.PendingEmail, true)
+		case user.EmailVerifiedAt == nil:
+			err = sendEmailVerification(mail, appBaseURL, userID, user.FirstName, user.Email, false)
+		default:
+			http.Error(w, "email is already verified", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to issue email verification for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Email verification resent - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "verification email sent",
+		})
+	}
+}
+
+func CancelEmailChange(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		if err := db.CancelPendingEmail(r.Context(), pool, userID); err != nil {
+			log.Printf("ERROR: Failed to cancel email change for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Email change cancelled - User: %d", userID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"archive/zip"
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exportProfile is the part of the user record included in exports, leaving out credentials
+type exportProfile struct {
+	ID                   int64      `json:"id"`
+	Username             string     `json:"username"`
+	Email                string     `json:"email"`
+	FirstName            string     `json:"first_name"`
+	LastName             string     `json:"last_name"`
+	Theme                string     `json:"theme"`
+	CreatedAt            time.Time  `json:"created_at"`
+	LastLogin            *time.Time `json:"last_login"`
+	EmailVerifiedAt      *time.Time `json:"email_verified_at"`
+	PendingEmail         *string    `json:"pending_email"`
+	TOTPEnabled          bool       `json:"totp_enabled"`
+	DeletionScheduledFor *time.Time `json:"deletion_scheduled_for"`
+}
+
+// ExportUserData returns a ZIP archive of everything stored for the caller, each dataset as both JSON and CSV.
+func ExportUserData(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user %d for export: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		datasets, err := collectUserExport(r.Context(), pool, user)
+		if err != nil {
+			log.Printf("ERROR: Failed to collect export data for user %d: %v", userID, err)
+			http.Error(w, "failed to export data", http.StatusInternalServerError)
+			return
+		}
+
+		// Build the archive in memory so a failure can still be reported with a proper status
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, dataset := range datasets {
+			if err := writeExportDataset(zw, dataset.name, dataset.rows); err != nil {
+				log.Printf("ERROR: Failed to write %s export for user %d: %v", dataset.name, userID, err)
+				http.Error(w, "failed to export data", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("ERROR: Failed to finish export archive for user %d: %v", userID, err)
+			http.Error(w, "failed to export data", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Data export generated - User: %d, Size: %d bytes", userID, buf.Len())
+
+		filename := fmt.Sprintf("budgee-export-%s-%s.zip", user.Username, time.Now().UTC().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Write(buf.Bytes())
+	}
+}
+
+type exportDataset struct {
+	name string
+	rows interface{}
+}
+
+func collectUserExport(ctx context.Context, pool *pgxpool.Pool, user *models.User) ([]exportDataset, error) {
+	profile := []exportProfile{{
+		ID:                   user.ID,
+		Username:             user.Username,
+		Email:                user.Email,
+		FirstName:            user.FirstName,
+		LastName:             user.LastName,
+		Theme:                user.Theme,
+		CreatedAt:            user.CreatedAt,
+		LastLogin:            user.LastLogin,
+		EmailVerifiedAt:      user.EmailVerifiedAt,
+		PendingEmail:         user.PendingEmail,
+		TOTPEnabled:          user.TOTPEnabled,
+		DeletionScheduledFor: user.DeletionScheduledFor,
+	}}
+
+	items, err := db.GetPlaidItemsSQL(ctx, pool, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get items: %w", err)
+	}
+
+	accounts := []models.Account{}
+	transactions := []models.Transaction{}
+	for _, item := range items {
+		itemAccounts, err := db.GetAccountsForUserAndItemSQL(ctx, pool, user.ID, item.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get accounts for item %s: %w", item.ItemID, err)
+		}
+		accounts = append(accounts, itemAccounts...)
+
+		for _, account := range itemAccounts {
+			accountTransactions, err := db.GetTransactionsSQL(ctx, pool, user.ID, account.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get transactions for account %s: %w", account.ID, err)
+			}
+			transactions = append(transactions, accountTransactions...)
+		}
+	}
+
+	budgets, err := db.GetAllBudgetsForUser(ctx, pool, int(user.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budgets: %w", err)
+	}
+
+	rules, err := db.GetAllTransactionRules(ctx, pool, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction rules: %w", err)
+	}
+
+	holdings, err := db.GetLatestHoldings(ctx, pool, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holdings: %w", err)
+	}
+
+	investmentTransactions, err := db.GetInvestmentTransactions(ctx, pool, user.ID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get investment transactions: %w", err)
+	}
+
+	liabilities, err := db.GetLiabilities(ctx, pool, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get liabilities: %w", err)
+	}
+
+	recurringStreams, err := db.GetRecurringStreams(ctx, pool, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring streams: %w", err)
+	}
+
+	if items == nil {
+		items = []models.PlaidItem{}
+	}
+	if budgets == nil {
+		budgets = []models.Budget{}
+	}
+	if rules == nil {
+		rules = []models.TransactionRule{}
+	}
+
+	return []exportDataset{
+		{"profile", profile},
+		{"items", items},
+		{"accounts", accounts},
+		{"transactions", transactions},
+		{"budgets", budgets},
+		{"transaction_rules", rules},
+		{"holdings", holdings},
+		{"investment_transactions", investmentTransactions},
+		{"liabilities", liabilities},
+		{"recurring_streams", recurringStreams},
+	}, nil
+}
+
+// writeExportDataset adds <name>.json and <name>.csv to the archive. rows must be a slice of structs, the
+// CSV columns follow the structs' JSON field names so both files describe the data the same way.
+func writeExportDataset(zw *zip.Writer, name string, rows interface{}) error {
+	jsonFile, err := zw.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(jsonFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(rows); err != nil {
+		return err
+	}
+
+	csvFile, err := zw.Create(name + ".csv")
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(csvFile)
+
+	slice := reflect.ValueOf(rows)
+	elemType := slice.Type().Elem()
+
+	var header []string
+	var fieldIndexes []int
+	for i := 0; i < elemType.NumField(); i++ {
+		tag, _, _ := strings.Cut(elemType.Field(i).Tag.Get("json"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		header = append(header, tag)
+		fieldIndexes = append(fieldIndexes, i)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i := 0; i < slice.Len(); i++ {
+		row := make([]string, len(fieldIndexes))
+		for j, fieldIndex := range fieldIndexes {
+			row[j] = exportCSVValue(slice.Index(i).Field(fieldIndex))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportCSVValue(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case json.RawMessage:
+		return string(value)
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map:
+		encoded, err := json.Marshal(v.Interface())
+		if err != nil {
+			return fmt.Sprint(v.Interface())
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
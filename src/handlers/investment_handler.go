@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/jobs"
+	"budgee-server/src/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+const (
+	// Plaid keeps up to 24 months of investment transactions
+	investmentHistoryDays = 730
+	// Later syncs refetch this many days before the newest stored transaction to pick up late changes
+	investmentOverlapDays = 30
+	// Largest page /investments/transactions/get returns
+	investmentTransactionsPageSize int32 = 500
+)
+
+// SyncHoldingsJob handles JobKindSyncHoldings jobs by storing a snapshot of the item's current holdings.
+func SyncHoldingsJob(plaidClient *plaid.APIClient, pool *pgxpool.Pool) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		item, err := productJobItem(ctx, pool, job)
+		if err != nil || item == nil {
+			return err
+		}
+
+		request := plaid.NewInvestmentsHoldingsGetRequest(item.AccessToken)
+		resp, _, err := plaidClient.PlaidApi.InvestmentsHoldingsGet(ctx).InvestmentsHoldingsGetRequest(*request).Execute()
+		if err != nil {
+			return handleProductFetchError(ctx, pool, item, err)
+		}
+
+		saved, err := db.SaveHoldingsSnapshot(ctx, pool, item.ItemID, resp.GetSecurities(), resp.GetHoldings())
+		if err != nil {
+			return fmt.Errorf("failed to save holdings for item %s: %w", item.ItemID, err)
+		}
+		log.Printf("INFO: Saved %d holdings for item %s", saved, item.ItemID)
+		return nil
+	}
+}
+
+// SyncInvestmentTransactionsJob handles JobKindSyncInvestmentTransactions jobs. The first run fetches the full
+// history Plaid keeps, later ones only the recent past.
+func SyncInvestmentTransactionsJob(plaidClient *plaid.APIClient, pool *pgxpool.Pool) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		item, err := productJobItem(ctx, pool, job)
+		if err != nil || item == nil {
+			return err
+		}
+
+		endDate := time.Now().UTC()
+		startDate := endDate.AddDate(0, 0, -investmentHistoryDays)
+		latest, err := db.GetLatestInvestmentTransactionDate(ctx, pool, item.ItemID)
+		if err != nil {
+			return err
+		}
+		if latest != nil && latest.AddDate(0, 0, -investmentOverlapDays).After(startDate) {
+			startDate = latest.AddDate(0, 0, -investmentOverlapDays)
+		}
+
+		var securities []plaid.Security
+		var transactions []plaid.InvestmentTransaction
+		for {
+			options := plaid.NewInvestmentsTransactionsGetRequestOptions()
+			options.SetCount(investmentTransactionsPageSize)
+			options.SetOffset(int32(len(transactions)))
+
+			request := plaid.NewInvestmentsTransactionsGetRequest(item.AccessToken, startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+			request.SetOptions(*options)
+			resp, _, err := plaidClient.PlaidApi.InvestmentsTransactionsGet(ctx).InvestmentsTransactionsGetRequest(*request).Execute()
+			if err != nil {
+				return handleProductFetchError(ctx, pool, item, err)
+			}
+
+			securities = append(securities, resp.GetSecurities()...)
+			transactions = append(transactions, resp.GetInvestmentTransactions()...)
+			if len(resp.GetInvestmentTransactions()) == 0 || len(transactions) >= int(resp.GetTotalInvestmentTransactions()) {
+				break
+			}
+		}
+
+		saved, err := db.SaveInvestmentTransactions(ctx, pool, item.ItemID, securities, transactions)
+		if err != nil {
+			return fmt.Errorf("failed to save investment transactions for item %s: %w", item.ItemID, err)
+		}
+		log.Printf("INFO: Saved %d investment transactions for item %s", saved, item.ItemID)
+		return nil
+	}
+}
+
+func GetHoldings(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		holdings, err := db.GetLatestHoldings(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get holdings for user %d: %v", userID, err)
+			http.Error(w, "failed to get holdings", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(holdings)
+	}
+}
+
+func GetInvestmentTransactions(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		var accountID *int
+		if raw := r.URL.Query().Get("account_id"); raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil {
+				http.Error(w, "invalid account_id", http.StatusBadRequest)
+				return
+			}
+			accountID = &id
+		}
+
+		transactions, err := db.GetInvestmentTransactions(r.Context(), pool, userID, accountID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get investment transactions for user %d: %v", userID, err)
+			http.Error(w, "failed to get investment transactions", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(transactions)
+	}
+}
+
+// GetPortfolioValue returns the total value of the user's investments and the value of each account.
+func GetPortfolioValue(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		accounts, err := db.GetPortfolioValue(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get portfolio value for user %d: %v", userID, err)
+			http.Error(w, "failed to get portfolio value", http.StatusInternalServerError)
+			return
+		}
+
+		total := 0.0
+		for _, account := range accounts {
+			total += account.Value
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total":    total,
+			"accounts": accounts,
+		})
+	}
+}
+
+func GetInvestmentAllocation(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		allocation, err := db.GetAllocationBySecurityType(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get investment allocation for user %d: %v", userID, err)
+			http.Error(w, "failed to get allocation", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(allocation)
+	}
+}
+
+func GetCostBasis(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		accounts, err := db.GetCostBasisByAccount(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get cost basis for user %d: %v", userID, err)
+			http.Error(w, "failed to get cost basis", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(accounts)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/util"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const defaultInvitationTTL = 7 * 24 * time.Hour
+
+var invitationRoles = map[string]bool{
+	"user":        true,
+	"super_admin": true,
+}
+
+var invitationStatuses = map[string]bool{
+	"":        true,
+	"pending": true,
+	"used":    true,
+	"expired": true,
+	"revoked": true,
+}
+
+func CreateInvitation(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID := r.Context().Value("user_id").(int64)
+
+		var req struct {
+			Email          *string `json:"email"`
+			Role           *string `json:"role"`
+			ExpiresInHours *int    `json:"expires_in_hours"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode create invitation request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.Email != nil {
+			email := strings.ToLower(strings.TrimSpace(*req.Email))
+			if email == "" {
+				req.Email = nil
+			} else if !util.ValidateEmail(email) {
+				log.Printf("ERROR: Email validation failed during invitation creation - Email: %s", email)
+				http.Error(w, "invalid email format", http.StatusBadRequest)
+				return
+			} else {
+				req.Email = &email
+			}
+		}
+
+		if req.Role != nil && !invitationRoles[*req.Role] {
+			exists, err := db.RoleExists(r.Context(), pool, *req.Role)
+			if err != nil {
+				log.Printf("ERROR: Failed to look up role %s for invitation: %v", *req.Role, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if !exists {
+				http.Error(w, "invalid role", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ttl := defaultInvitationTTL
+		if req.ExpiresInHours != nil {
+			if *req.ExpiresInHours <= 0 {
+				http.Error(w, "expires_in_hours must be positive", http.StatusBadRequest)
+				return
+			}
+			ttl = time.Duration(*req.ExpiresInHours) * time.Hour
+		}
+
+		code, err := util.GenerateRandomToken(16)
+		if err != nil {
+			log.Printf("ERROR: Failed to generate invitation code: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		invitation, err := db.CreateInvitation(r.Context(), pool, req.Email, util.HashToken(code), req.Role, adminID, time.Now().UTC().Add(ttl))
+		if err != nil {
+			log.Printf("ERROR: Failed to create invitation: %v", err)
+			http.Error(w, "failed to create", http.StatusInternalServerError)
+			return
+		}
+
+		audit := util.Audit(r)
+		audit.Action = "invitation.create"
+		audit.TargetType = "invitation"
+		audit.TargetID = strconv.FormatInt(invitation.ID, 10)
+		audit.After = invitation
+
+		log.Printf("INFO: Invitation created - ID: %d, Invited by: %d", invitation.ID, adminID)
+
+		// The code is only ever returned here; the database keeps just its hash
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"invitation": invitation,
+			"code":       code,
+		})
+	}
+}
+
+func GetInvitations(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		if !invitationStatuses[status] {
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+
+		invitations, err := db.GetInvitations(r.Context(), pool, status)
+		if err != nil {
+			log.Printf("ERROR: Failed to get invitations: %v", err)
+			http.Error(w, "failed to get invitations", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(invitations)
+	}
+}
+
+func RevokeInvitation(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "invitation_id")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Invalid invitation id param for revoke: %s", idStr)
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		audit := util.Audit(r)
+		audit.Action = "invitation.revoke"
+		audit.TargetType = "invitation"
+		err = db.RevokeInvitation(r.Context(), pool, id)
+		if err != nil {
+			log.Printf("ERROR: Failed to revoke invitation id %d: %v", id, err)
+			http.Error(w, "invitation not found or already used", http.StatusNotFound)
+			return
+		}
+		log.Printf("INFO: Invitation revoked - ID: %d", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
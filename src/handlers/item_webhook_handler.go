@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// itemWebhook holds the fields of the Plaid ITEM webhooks that are handled
+type itemWebhook struct {
+	WebhookCode string `json:"webhook_code"`
+	ItemID      string `json:"item_id"`
+	Error       *struct {
+		ErrorCode    string `json:"error_code"`
+		ErrorMessage string `json:"error_message"`
+	} `json:"error"`
+	ConsentExpirationTime *time.Time `json:"consent_expiration_time"`
+	Reason                string     `json:"reason"`
+	NewWebhookURL         string     `json:"new_webhook_url"`
+}
+
+// handleItemWebhook updates the stored health of an item from an ITEM webhook so the frontend can prompt
+// the user to repair the connection.
+func handleItemWebhook(ctx context.Context, pool *pgxpool.Pool, body []byte) error {
+	var hook itemWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return fmt.Errorf("failed to decode item webhook: %w", err)
+	}
+
+	switch hook.WebhookCode {
+	case "ERROR":
+		errorCode, errorMessage := "", ""
+		if hook.Error != nil {
+			errorCode, errorMessage = hook.Error.ErrorCode, hook.Error.ErrorMessage
+		}
+		log.Printf("INFO: Plaid item entered error state - Item: %s, Error: %s", hook.ItemID, errorCode)
+		return db.SetPlaidItemError(ctx, pool, hook.ItemID, models.ItemStatusError, errorCode, errorMessage)
+
+	case "LOGIN_REPAIRED":
+		log.Printf("INFO: Plaid item login repaired - Item: %s", hook.ItemID)
+		return db.ClearPlaidItemError(ctx, pool, hook.ItemID)
+
+	case "PENDING_EXPIRATION":
+		log.Printf("INFO: Plaid item consent expiring - Item: %s, Expires: %v", hook.ItemID, hook.ConsentExpirationTime)
+		return db.SetPlaidItemConsentExpiration(ctx, pool, hook.ItemID, hook.ConsentExpirationTime)
+
+	case "PENDING_DISCONNECT":
+		// The reason, such as INSTITUTION_MIGRATION, is kept as the error code
+		log.Printf("INFO: Plaid item pending disconnect - Item: %s, Reason: %s", hook.ItemID, hook.Reason)
+		return db.SetPlaidItemError(ctx, pool, hook.ItemID, models.ItemStatusPendingDisconnect, hook.Reason, "")
+
+	case "USER_PERMISSION_REVOKED", "USER_ACCOUNT_REVOKED":
+		errorCode := hook.WebhookCode
+		errorMessage := ""
+		if hook.Error != nil && hook.Error.ErrorCode != "" {
+			errorCode, errorMessage = hook.Error.ErrorCode, hook.Error.ErrorMessage
+		}
+		log.Printf("INFO: Plaid item access revoked by user - Item: %s", hook.ItemID)
+		return db.SetPlaidItemError(ctx, pool, hook.ItemID, models.ItemStatusRevoked, errorCode, errorMessage)
+
+	case "NEW_ACCOUNTS_AVAILABLE":
+		log.Printf("INFO: Plaid item has new accounts available - Item: %s", hook.ItemID)
+		return db.SetPlaidItemNewAccountsAvailable(ctx, pool, hook.ItemID, true)
+
+	case "WEBHOOK_UPDATE_ACKNOWLEDGED":
+		if hook.Error != nil && hook.Error.ErrorCode != "" {
+			log.Printf("ERROR: Plaid webhook update failed - Item: %s, Error: %s", hook.ItemID, hook.Error.ErrorCode)
+			return nil
+		}
+		log.Printf("INFO: Plaid webhook update acknowledged - Item: %s, URL: %s", hook.ItemID, hook.NewWebhookURL)
+		return db.SetPlaidItemWebhookURL(ctx, pool, hook.ItemID, hook.NewWebhookURL)
+
+	default:
+		log.Printf("INFO: Received unhandled Plaid item webhook - Item: %s, Webhook Code: %s", hook.ItemID, hook.WebhookCode)
+		return nil
+	}
+}
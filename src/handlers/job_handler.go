@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultJobPageSize = 50
+	maxJobPageSize     = 500
+)
+
+// GetJobs lists background jobs newest first. Supported filters: status and kind, plus page and page_size.
+func GetJobs(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		filter := models.JobFilter{
+			Status: q.Get("status"),
+			Kind:   q.Get("kind"),
+			Limit:  defaultJobPageSize,
+		}
+
+		page := 1
+		if v := q.Get("page"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid page", http.StatusBadRequest)
+				return
+			}
+			page = n
+		}
+		if v := q.Get("page_size"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxJobPageSize {
+				http.Error(w, "page_size must be between 1 and "+strconv.Itoa(maxJobPageSize), http.StatusBadRequest)
+				return
+			}
+			filter.Limit = n
+		}
+		filter.Offset = (page - 1) * filter.Limit
+
+		jobs, total, err := db.GetJobs(r.Context(), pool, filter)
+		if err != nil {
+			log.Printf("ERROR: Failed to get jobs: %v", err)
+			http.Error(w, "failed to get jobs", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jobs":      jobs,
+			"total":     total,
+			"page":      page,
+			"page_size": filter.Limit,
+		})
+	}
+}
+
+// RetryJob requeues a dead or cancelled job with a fresh set of attempts.
+func RetryJob(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := parseJobID(w, r)
+		if !ok {
+			return
+		}
+		audit := util.Audit(r)
+		audit.Action = "job.retry"
+		audit.TargetType = "job"
+		if before, err := db.GetJobByID(r.Context(), pool, jobID); err == nil {
+			audit.Before = before
+		}
+
+		job, err := db.RetryJob(r.Context(), pool, jobID)
+		if err != nil {
+			if errors.Is(err, db.ErrJobNotFound) {
+				http.Error(w, "job not found or not dead or cancelled", http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, db.ErrJobAlreadyQueued) {
+				http.Error(w, "the same work is already queued", http.StatusConflict)
+				return
+			}
+			log.Printf("ERROR: Failed to retry job %d: %v", jobID, err)
+			http.Error(w, "failed to retry job", http.StatusInternalServerError)
+			return
+		}
+		audit.After = job
+
+		log.Printf("INFO: Job %d requeued by admin", jobID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// CancelJob cancels a job that is still waiting to run.
+func CancelJob(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := parseJobID(w, r)
+		if !ok {
+			return
+		}
+		audit := util.Audit(r)
+		audit.Action = "job.cancel"
+		audit.TargetType = "job"
+
+		job, err := db.CancelJob(r.Context(), pool, jobID)
+		if err != nil {
+			if errors.Is(err, db.ErrJobNotFound) {
+				http.Error(w, "job not found or not queued", http.StatusNotFound)
+				return
+			}
+			log.Printf("ERROR: Failed to cancel job %d: %v", jobID, err)
+			http.Error(w, "failed to cancel job", http.StatusInternalServerError)
+			return
+		}
+		audit.After = job
+
+		log.Printf("INFO: Job %d cancelled by admin", jobID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+func parseJobID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	idStr := chi.URLParam(r, "job_id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Printf("ERROR: Invalid job id param: %s", idStr)
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/jobs"
+	"budgee-server/src/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// SyncLiabilitiesJob handles JobKindSyncLiabilities jobs by replacing the item's stored liabilities with
+// what Plaid currently reports.
+func SyncLiabilitiesJob(plaidClient *plaid.APIClient, pool *pgxpool.Pool) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		item, err := productJobItem(ctx, pool, job)
+		if err != nil || item == nil {
+			return err
+		}
+
+		request := plaid.NewLiabilitiesGetRequest(item.AccessToken)
+		resp, _, err := plaidClient.PlaidApi.LiabilitiesGet(ctx).LiabilitiesGetRequest(*request).Execute()
+		if err != nil {
+			return handleProductFetchError(ctx, pool, item, err)
+		}
+
+		liabilities, err := liabilitiesFromPlaid(resp.GetLiabilities())
+		if err != nil {
+			return err
+		}
+		saved, err := db.ReplaceItemLiabilities(ctx, pool, item.ItemID, liabilities)
+		if err != nil {
+			return fmt.Errorf("failed to save liabilities for item %s: %w", item.ItemID, err)
+		}
+		log.Printf("INFO: Saved %d liabilities for item %s", saved, item.ItemID)
+		return nil
+	}
+}
+
+// liabilitiesFromPlaid flattens Plaid's credit, student and mortgage groups into liabilities.
+func liabilitiesFromPlaid(object plaid.LiabilitiesObject) ([]models.Liability, error) {
+	var liabilities []models.Liability
+
+	for _, credit := range object.GetCredit() {
+		details, err := json.Marshal(map[string]interface{}{"aprs": credit.GetAprs()})
+		if err != nil {
+			return nil, err
+		}
+		rate, rateType := creditCardInterestRate(credit.GetAprs())
+		liabilities = append(liabilities, models.Liability{
+			PlaidAccountID:         credit.GetAccountId(),
+			Type:                   models.LiabilityTypeCredit,
+			InterestRatePercentage: rate,
+			InterestRateType:       rateType,
+			MinimumPaymentAmount:   credit.MinimumPaymentAmount.Get(),
+			NextPaymentDueDate:     parsePlaidDate(credit.NextPaymentDueDate.Get()),
+			LastPaymentAmount:      credit.LastPaymentAmount.Get(),
+			LastPaymentDate:        parsePlaidDate(credit.LastPaymentDate.Get()),
+			LastStatementBalance:   credit.LastStatementBalance.Get(),
+			LastStatementIssueDate: parsePlaidDate(credit.LastStatementIssueDate.Get()),
+			IsOverdue:              credit.IsOverdue.Get(),
+			Details:                details,
+		})
+	}
+
+	for _, student := range object.GetStudent() {
+		details, err := json.Marshal(map[string]interface{}{
+			"loan_status":                 student.GetLoanStatus(),
+			"repayment_plan":              student.GetRepaymentPlan(),
+			"guarantor":                   student.Guarantor.Get(),
+			"outstanding_interest_amount": student.OutstandingInterestAmount.Get(),
+			"ytd_interest_paid":           student.YtdInterestPaid.Get(),
+			"ytd_principal_paid":          student.YtdPrincipalPaid.Get(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		rate := student.GetInterestRatePercentage()
+		liabilities = append(liabilities, models.Liability{
+			PlaidAccountID:             student.GetAccountId(),
+			Type:                       models.LiabilityTypeStudent,
+			InterestRatePercentage:     &rate,
+			MinimumPaymentAmount:       student.MinimumPaymentAmount.Get(),
+			NextPaymentDueDate:         parsePlaidDate(student.NextPaymentDueDate.Get()),
+			LastPaymentAmount:          student.LastPaymentAmount.Get(),
+			LastPaymentDate:            parsePlaidDate(student.LastPaymentDate.Get()),
+			LastStatementBalance:       student.LastStatementBalance.Get(),
+			LastStatementIssueDate:     parsePlaidDate(student.LastStatementIssueDate.Get()),
+			IsOverdue:                  student.IsOverdue.Get(),
+			OriginationDate:            parsePlaidDate(student.OriginationDate.Get()),
+			OriginationPrincipalAmount: student.OriginationPrincipalAmount.Get(),
+			PayoffDate:                 parsePlaidDate(student.ExpectedPayoffDate.Get()),
+			LoanName:                   student.LoanName.Get(),
+			Details:                    details,
+		})
+	}
+
+	for _, mortgage := range object.GetMortgage() {
+		details, err := json.Marshal(map[string]interface{}{
+			"loan_type_description":  mortgage.LoanTypeDescription.Get(),
+			"escrow_balance":         mortgage.EscrowBalance.Get(),
+			"has_pmi":                mortgage.HasPmi.Get(),
+			"has_prepayment_penalty": mortgage.HasPrepaymentPenalty.Get(),
+			"past_due_amount":        mortgage.PastDueAmount.Get(),
+			"current_late_fee":       mortgage.CurrentLateFee.Get(),
+			"ytd_interest_paid":      mortgage.YtdInterestPaid.Get(),
+			"ytd_principal_paid":     mortgage.YtdPrincipalPaid.Get(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		interestRate := mortgage.GetInterestRate()
+		liabilities = append(liabilities, models.Liability{
+			PlaidAccountID:             mortgage.GetAccountId(),
+			Type:                       models.LiabilityTypeMortgage,
+			InterestRatePercentage:     interestRate.Percentage.Get(),
+			InterestRateType:           interestRate.Type.Get(),
+			MinimumPaymentAmount:       mortgage.NextMonthlyPayment.Get(),
+			NextPaymentDueDate:         parsePlaidDate(mortgage.NextPaymentDueDate.Get()),
+			LastPaymentAmount:          mortgage.LastPaymentAmount.Get(),
+			LastPaymentDate:            parsePlaidDate(mortgage.LastPaymentDate.Get()),
+			OriginationDate:            parsePlaidDate(mortgage.OriginationDate.Get()),
+			OriginationPrincipalAmount: mortgage.OriginationPrincipalAmount.Get(),
+			PayoffDate:                 parsePlaidDate(mortgage.MaturityDate.Get()),
+			LoanTerm:                   mortgage.LoanTerm.Get(),
+			Details:                    details,
+		})
+	}
+
+	return liabilities, nil
+}
+
+// creditCardInterestRate picks the rate that describes a card: the purchase APR when there is one, otherwise
+// the highest APR.
+func creditCardInterestRate(aprs []plaid.APR) (*float64, *string) {
+	var best *plaid.APR
+	for i := range aprs {
+		apr := &aprs[i]
+		if apr.GetAprType() == "purchase_apr" {
+			best = apr
+			break
+		}
+		if best == nil || apr.GetAprPercentage() > best.GetAprPercentage() {
+			best = apr
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	rate, rateType := best.GetAprPercentage(), best.GetAprType()
+	return &rate, &rateType
+}
+
+// parsePlaidDate parses a YYYY-MM-DD date from Plaid, returning nil when it is missing or malformed.
+func parsePlaidDate(value *string) *time.Time {
+	if value == nil || *value == "" {
+		return nil
+	}
+	parsed, err := time.Parse("2006-01-02", *value)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+// GetLiabilities returns the user's liabilities along with their total debt, its balance-weighted interest
+// rate and the payments that are coming due.
+func GetLiabilities(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		liabilities, err := db.GetLiabilities(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get liabilities for user %d: %v", userID, err)
+			http.Error(w, "failed to get liabilities", http.StatusInternalServerError)
+			return
+		}
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		totalDebt := 0.0
+		ratedDebt := 0.0
+		weightedRate := 0.0
+		upcoming := []models.Liability{}
+		for _, l := range liabilities {
+			totalDebt += l.CurrentBalance
+			if l.InterestRatePercentage != nil {
+				ratedDebt += l.CurrentBalance
+				weightedRate += l.CurrentBalance * *l.InterestRatePercentage
+			}
+			// Liabilities are ordered by due date, so the upcoming ones stay in order
+			if l.NextPaymentDueDate != nil && !l.NextPaymentDueDate.Before(today) {
+				upcoming = append(upcoming, l)
+			}
+		}
+
+		var averageRate *float64
+		if ratedDebt != 0 {
+			rate := weightedRate / ratedDebt
+			averageRate = &rate
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"total_debt":             totalDebt,
+			"weighted_interest_rate": averageRate,
+			"upcoming_payments":      upcoming,
+			"liabilities":            liabilities,
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"budgee-server/src/config"
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func GetUserLoginFailures(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestedUserID := chi.URLParam(r, "user_id")
+		userID, err := strconv.ParseInt(requestedUserID, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Failed to parse user_id from URL - user_id: %s: %v", requestedUserID, err)
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user for login failures - user_id: %d: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		failure, err := db.GetUserLoginFailure(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get login failures for user %d: %v", userID, err)
+			http.Error(w, "failed to get login failures", http.StatusInternalServerError)
+			return
+		}
+
+		failureCount := 0
+		var lastFailureAt *time.Time
+		if failure != nil {
+			failureCount = failure.FailureCount
+			lastFailureAt = &failure.LastFailureAt
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"user_id":         userID,
+			"failure_count":   failureCount,
+			"last_failure_at": lastFailureAt,
+			"locked":          user.Locked,
+			"locked_until":    user.LockedUntil,
+		})
+	}
+}
+
+func ClearUserLoginFailures(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestedUserID := chi.URLParam(r, "user_id")
+		userID, err := strconv.ParseInt(requestedUserID, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Failed to parse user_id from URL - user_id: %s: %v", requestedUserID, err)
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		err = db.ClearUserLoginFailures(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to clear login failures for user %d: %v", userID, err)
+			http.Error(w, "failed to clear login failures", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Login failures cleared for user %d", userID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "login failures cleared",
+		})
+	}
+}
+
+func GetAllLoginFailures(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		failures, err := db.GetAllLoginFailures(r.Context(), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get all login failures: %v", err)
+			http.Error(w, "failed to get login failures", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(failures)
+	}
+}
+
+func ClearIPLoginFailures(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ipAddress := chi.URLParam(r, "ip_address")
+		if ipAddress == "" {
+			http.Error(w, "invalid ip address", http.StatusBadRequest)
+			return
+		}
+
+		err := db.ClearIPLoginFailures(r.Context(), pool, ipAddress)
+		if err != nil {
+			log.Printf("ERROR: Failed to clear login failures for IP %s: %v", ipAddress, err)
+			http.Error(w, "failed to clear login failures", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Login failures cleared for IP %s", ipAddress)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "login failures cleared",
+		})
+	}
+}
+
+// loginRetryAfter returns how long a caller must wait before another login attempt is accepted.
+// The first FreeAttempts failures carry no delay; after that the delay doubles with each failure.
+func loginRetryAfter(failure *models.LoginFailure, policy config.LoginThrottleConfig, now time.Time) time.Duration {
+	if failure == nil || failure.FailureCount <= policy.FreeAttempts {
+		return 0
+	}
+	if now.Sub(failure.LastFailureAt) > policy.FailureWindow {
+		return 0
+	}
+	delay := util.ExponentialBackoff(failure.FailureCount-policy.FreeAttempts, policy.BackoffBase, policy.BackoffMax)
+	wait := failure.LastFailureAt.Add(delay).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+func writeTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// recordFailedLogin bumps the IP counter and, when the account is known, the account counter.
+// Reaching the lockout threshold locks the account until the configured lockout duration has passed.
+func recordFailedLogin(r *http.Request, pool *pgxpool.Pool, policy config.LoginThrottleConfig, user *models.User, ipAddress string) {
+	if _, err := db.RecordIPLoginFailure(r.Context(), pool, ipAddress, policy.FailureWindow); err != nil {
+		log.Printf("ERROR: Failed to record login failure for IP %s: %v", ipAddress, err)
+	}
+
+	if user == nil {
+		return
+	}
+
+	failure, err := db.RecordUserLoginFailure(r.Context(), pool, user.ID, policy.FailureWindow)
+	if err != nil {
+		log.Printf("ERROR: Failed to record login failure for user %d: %v", user.ID, err)
+		return
+	}
+
+	if policy.LockoutThreshold > 0 && failure.FailureCount >= policy.LockoutThreshold && !user.Locked {
+		lockedUntil := time.Now().UTC().Add(policy.LockoutDuration)
+		locked, err := db.LockUserUntil(r.Context(), pool, user.ID, lockedUntil)
+		if err != nil {
+			log.Printf("ERROR: Failed to lock user %d after repeated login failures: %v", user.ID, err)
+			return
+		}
+		if !locked {
+			return
+		}
+		if _, err := db.RevokeAllSessionsForUser(r.Context(), pool, user.ID); err != nil {
+			log.Printf("ERROR: Failed to revoke sessions for locked user %d: %v", user.ID, err)
+		}
+		log.Printf("INFO: User %d automatically locked until %s after %d failed login attempts", user.ID, lockedUntil.Format(time.RFC3339), failure.FailureCount)
+	}
+}
+
+func clearLoginFailures(r *http.Request, pool *pgxpool.Pool, userID int64, ipAddress string) {
+	if err := db.ClearUserLoginFailures(r.Context(), pool, userID); err != nil {
+		log.Printf("ERROR: Failed to clear login failures for user %d: %v", userID, err)
+	}
+	if err := db.ClearIPLoginFailures(r.Context(), pool, ipAddress); err != nil {
+		log.Printf("ERROR: Failed to clear login failures for IP %s: %v", ipAddress, err)
+	}
+}
+
+// unlockIfLockoutExpired lifts an automatic lockout once locked_until has passed.
+// Locks placed by an admin have no locked_until and are left alone.
+func unlockIfLockoutExpired(r *http.Request, pool *pgxpool.Pool, user *models.User) {
+	if !user.Locked || user.LockedUntil == nil || time.Now().UTC().Before(*user.LockedUntil) {
+		return
+	}
+	if err := db.UnlockUser(r.Context(), pool, user.ID); err != nil {
+		log.Printf("ERROR: Failed to lift expired lockout for user %d: %v", user.ID, err)
+		return
+	}
+	if err := db.ClearUserLoginFailures(r.Context(), pool, user.ID); err != nil {
+		log.Printf("ERROR: Failed to clear login failures for user %d: %v", user.ID, err)
+	}
+	user.Locked = false
+	user.LockedUntil = nil
+	log.Printf("INFO: Automatic lockout expired for user %d", user.ID)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const loginHistoryLimit = 100
+
+func GetLoginHistory(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		sessions, err := db.GetActiveSessionsForUser(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get sessions for user %d: %v", userID, err)
+			http.Error(w, "failed to get sessions", http.StatusInternalServerError)
+			return
+		}
+
+		events, err := db.GetLoginEventsForUser(r.Context(), pool, userID, loginHistoryLimit)
+		if err != nil {
+			log.Printf("ERROR: Failed to get login history for user %d: %v", userID, err)
+			http.Error(w, "failed to get login history", http.StatusInternalServerError)
+			return
+		}
+
+		currentSessionID, _ := r.Context().Value("session_id").(int64)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"current_session_id": currentSessionID,
+			"active_sessions":    sessions,
+			"login_history":      events,
+		})
+	}
+}
+
+func RevokeUserSession(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		idStr := chi.URLParam(r, "session_id")
+		sessionID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Invalid session id param for revoke: %s", idStr)
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+
+		err = db.RevokeSession(r.Context(), pool, sessionID, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to revoke session %d for user %d: %v", sessionID, userID, err)
+			http.Error(w, "failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: User %d revoked session %d", userID, sessionID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// recordLoginFailure stores a failed attempt in the login history. user is nil when the identifier matched no account.
+func recordLoginFailure(r *http.Request, pool *pgxpool.Pool, user *models.User, identifier, reason string) {
+	event := newLoginEvent(r)
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	if identifier != "" {
+		event.Identifier = &identifier
+	}
+	event.FailureReason = &reason
+
+	if err := db.InsertLoginEvent(r.Context(), pool, event); err != nil {
+		log.Printf("ERROR: Failed to record failed login: %v", err)
+	}
+}
+
+// recordLoginSuccess stores a completed login and, when it comes from a device or IP range the user has
+// never logged in from, flags the event and emails the user. A user's very first login is never flagged.
+func recordLoginSuccess(r *http.Request, pool *pgxpool.Pool, mail mailer.Mailer, user *models.User) {
+	event := newLoginEvent(r)
+	event.UserID = &user.ID
+	event.Identifier = &user.Username
+	event.Success = true
+
+	hasHistory, knownDevice, knownRange, err := db.GetKnownLoginOrigins(r.Context(), pool, user.ID, *event.DeviceFingerprint, *event.IPRange)
+	if err != nil {
+		log.Printf("ERROR: Failed to check login origins for user %d: %v", user.ID, err)
+	} else if hasHistory {
+		event.NewDevice = !knownDevice
+		event.NewIPRange = !knownRange
+	}
+
+	if err := db.InsertLoginEvent(r.Context(), pool, event); err != nil {
+		log.Printf("ERROR: Failed to record login for user %d: %v", user.ID, err)
+	}
+
+	if !event.NewDevice && !event.NewIPRange {
+		return
+	}
+
+	log.Printf("INFO: Login from new origin - User: %d, New device: %t, New IP range: %t, IP: %s",
+		user.ID, event.NewDevice, event.NewIPRange, *event.IPAddress)
+
+	body := fmt.Sprintf(
+		"Hi %s,\n\nYour Budgee account was just signed in to from a device or location we have not seen before.\n\nTime: %s\nIP address: %s\nDevice: %s\n\nIf this was you, no action is needed. If not, change your password right away and sign out of all sessions from your account settings.\n",
+		user.FirstName, time.Now().UTC().Format(time.RFC1123), *event.IPAddress, *event.UserAgent,
+	)
+	go func(to string, userID int64) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mail.Send(ctx, to, "New sign-in to your Budgee account", body); err != nil {
+			log.Printf("ERROR: Failed to send new sign-in email to user %d: %v", userID, err)
+		}
+	}(user.Email, user.ID)
+}
+
+func newLoginEvent(r *http.Request) models.LoginEvent {
+	ip := util.ClientIP(r)
+	ipRange := util.IPRange(ip)
+	userAgent := r.UserAgent()
+	fingerprint := util.DeviceFingerprint(r)
+	return models.LoginEvent{
+		IPAddress:         &ip,
+		IPRange:           &ipRange,
+		UserAgent:         &userAgent,
+		DeviceFingerprint: &fingerprint,
+	}
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"budgee-server/src/config"
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "Budgee"
+	recoveryCodeCount = 10
+)
+
+func EnrollTOTP(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user for TOTP enrollment - user_id: %d: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		if user.TOTPEnabled {
+			log.Printf("ERROR: TOTP enrollment attempted while already enabled - User: %d", userID)
+			http.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		secret, err := util.GenerateTOTPSecret()
+		if err != nil {
+			log.Printf("ERROR: Failed to generate TOTP secret for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		err = db.SetPendingTOTPSecret(r.Context(), pool, userID, secret)
+		if err != nil {
+			log.Printf("ERROR: Failed to store TOTP secret for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: TOTP enrollment started - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"secret":      secret,
+			"otpauth_url": util.TOTPProvisioningURI(totpIssuer, user.Email, secret),
+		})
+	}
+}
+
+func ConfirmTOTP(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode confirm TOTP request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user for TOTP confirmation - user_id: %d: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		if user.TOTPEnabled || user.TOTPSecret == nil {
+			http.Error(w, "no pending two-factor enrollment", http.StatusBadRequest)
+			return
+		}
+
+		secret, err := db.DecryptTOTPSecret(user)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		step, ok := util.ValidateTOTPCode(secret, req.Code, time.Now())
+		if !ok {
+			log.Printf("ERROR: Invalid TOTP code during enrollment - User: %d", userID)
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			log.Printf("ERROR: Failed to generate recovery codes for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		err = db.EnableTOTP(r.Context(), pool, userID, step, hashes)
+		if err != nil {
+			log.Printf("ERROR: Failed to enable TOTP for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: TOTP enabled - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":        "two-factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func DisableTOTP(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		var req struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode disable TOTP request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user for TOTP disable - user_id: %d: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		if !user.TOTPEnabled {
+			http.Error(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(req.Password)); err != nil {
+			log.Printf("ERROR: Invalid password attempt while disabling TOTP for user %d", userID)
+			http.Error(w, "invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		if !verifySecondFactor(r, pool, user, req.Code) {
+			log.Printf("ERROR: Invalid second factor while disabling TOTP for user %d", userID)
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		err = db.DisableTOTP(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to disable TOTP for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: TOTP disabled - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "two-factor authentication disabled"})
+	}
+}
+
+func RegenerateRecoveryCodes(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode regenerate recovery codes request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user for recovery code regeneration - user_id: %d: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		if !user.TOTPEnabled {
+			http.Error(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+
+		secret, err := db.DecryptTOTPSecret(user)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		step, ok := util.ValidateTOTPCode(secret, req.Code, time.Now())
+		if !ok {
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+		if consumed, err := db.ConsumeTOTPStep(r.Context(), pool, userID, step); err != nil || !consumed {
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			log.Printf("ERROR: Failed to generate recovery codes for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		err = db.RegenerateRecoveryCodes(r.Context(), pool, userID, hashes)
+		if err != nil {
+			log.Printf("ERROR: Failed to store recovery codes for user %d: %v", userID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Recovery codes regenerated - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// LoginMFA completes a two-step login. It accepts only the mfa_token returned by Login plus either
+// a current TOTP code or an unused recovery code.
+func LoginMFA(pool *pgxpool.Pool, throttle config.LoginThrottleConfig, mail mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MFAToken string `json:"mfa_token"`
+			Code     string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode MFA login request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		userID, identity, err := parseMFAPendingToken(req.MFAToken)
+		if err != nil {
+			log.Printf("ERROR: Invalid MFA token presented from IP %s: %v", util.ClientIP(r), err)
+			http.Error(w, "invalid or expired mfa token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to find user during MFA login - user_id: %d: %v", userID, err)
+			http.Error(w, "User not found", http.StatusUnauthorized)
+			return
+		}
+
+		if user.Locked {
+			log.Printf("ERROR: Locked user attempted MFA login - User: %d", userID)
+			recordLoginFailure(r, pool, user, user.Username, "locked")
+			http.Error(w, "User account is locked", http.StatusForbidden)
+			return
+		}
+
+		if !user.TOTPEnabled || user.TOTPSecret == nil {
+			http.Error(w, "two-factor authentication is not enabled", http.StatusBadRequest)
+			return
+		}
+
+		ipAddress := util.ClientIP(r)
+
+		userFailures, err := db.GetUserLoginFailure(r.Context(), pool, user.ID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get login failures for user %d: %v", user.ID, err)
+		}
+		if wait := loginRetryAfter(userFailures, throttle, time.Now().UTC()); wait > 0 {
+			log.Printf("ERROR: MFA login throttled for user %s, retry after %s", user.Username, wait)
+			recordLoginFailure(r, pool, user, user.Username, "throttled")
+			writeTooManyAttempts(w, wait)
+			return
+		}
+
+		if !verifySecondFactor(r, pool, user, req.Code) {
+			log.Printf("ERROR: Invalid second factor for user %s from IP %s", user.Username, ipAddress)
+			recordFailedLogin(r, pool, throttle, user, ipAddress)
+			recordLoginFailure(r, pool, user, user.Username, "invalid_second_factor")
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, refreshToken, err := createSessionTokens(r, pool, user.ID, user.Username, user.SuperAdmin)
+		if err != nil {
+			log.Printf("ERROR: Failed to create session for user %s: %v", user.Username, err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		clearLoginFailures(r, pool, user.ID, ipAddress)
+		linkOIDCIdentity(r, pool, user.ID, identity)
+		recordLoginSuccess(r, pool, mail, user)
+
+		err = db.UpdateUserLastLogin(pool, user.ID)
+		if err != nil {
+			log.Printf("ERROR: Failed to update last_login for user %s: %v", user.Username, err)
+		}
+
+		log.Printf("INFO: Successful MFA login - User: %s, ID: %d", user.Username, user.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokenResponse(accessToken, refreshToken))
+	}
+}
+
+// verifySecondFactor accepts either a TOTP code that has not been used before or an unused recovery code.
+// Recovery codes still work when the TOTP secret cannot be decrypted.
+func verifySecondFactor(r *http.Request, pool *pgxpool.Pool, user *models.User, code string) bool {
+	userID := user.ID
+	secret, err := db.DecryptTOTPSecret(user)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+	} else if step, ok := util.ValidateTOTPCode(secret, code, time.Now()); ok {
+		consumed, err := db.ConsumeTOTPStep(r.Context(), pool, userID, step)
+		if err != nil {
+			log.Printf("ERROR: Failed to record TOTP step for user %d: %v", userID, err)
+			return false
+		}
+		return consumed
+	}
+
+	consumed, err := db.ConsumeRecoveryCode(r.Context(), pool, userID, util.HashToken(util.NormalizeRecoveryCode(code)))
+	if err != nil {
+		log.Printf("ERROR: Failed to check recovery code for user %d: %v", userID, err)
+		return false
+	}
+	if consumed {
+		log.Printf("INFO: Recovery code used - User: %d", userID)
+	}
+	return consumed
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = util.HashToken(util.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
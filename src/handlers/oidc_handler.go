@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
+	"budgee-server/src/models"
+	"budgee-server/src/oidc"
+	"budgee-server/src/util"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// StartOIDCLogin begins an authorization code + PKCE flow and returns the provider URL to send the browser to.
+// New users must pass an invite_code here, the same gate Register applies.
+func StartOIDCLogin(pool *pgxpool.Pool, providers map[string]*oidc.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providerName := chi.URLParam(r, "provider")
+		provider, ok := providers[providerName]
+		if !ok {
+			http.Error(w, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			InviteCode string `json:"invite_code"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("ERROR: Failed to decode OIDC start request body: %v", err)
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		state, err1 := util.GenerateRandomToken(32)
+		nonce, err2 := util.GenerateRandomToken(16)
+		codeVerifier, err3 := util.GenerateRandomToken(32)
+		if err := errors.Join(err1, err2, err3); err != nil {
+			log.Printf("ERROR: Failed to generate OIDC state: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		loginState := models.OIDCLoginState{
+			Provider:     providerName,
+			Nonce:        nonce,
+			CodeVerifier: codeVerifier,
+		}
+		if code := strings.TrimSpace(req.InviteCode); code != "" {
+			codeHash := util.HashToken(code)
+			loginState.InviteCodeHash = &codeHash
+		}
+
+		authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, codeVerifier)
+		if err != nil {
+			log.Printf("ERROR: Failed to build authorization URL for provider %s: %v", providerName, err)
+			http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+			return
+		}
+
+		if err := db.CreateOIDCLoginState(r.Context(), pool, util.HashToken(state), loginState, oidcStateTTL); err != nil {
+			log.Printf("ERROR: Failed to store OIDC state: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_url": authURL,
+		})
+	}
+}
+
+// OIDCCallback completes the flow with the code and state the provider redirected back with. The signed-in
+// identity is matched to a user by a previous link, then by verified email, and otherwise registered
+// through the invitation given at the start. The response matches Login, including the MFA step.
+func OIDCCallback(pool *pgxpool.Pool, providers map[string]*oidc.Provider, mail mailer.Mailer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providerName := chi.URLParam(r, "provider")
+		provider, ok := providers[providerName]
+		if !ok {
+			http.Error(w, "unknown identity provider", http.StatusNotFound)
+			return
+		}
+
+		var req struct {
+			Code  string `json:"code"`
+			State string `json:"state"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" || req.State == "" {
+			log.Printf("ERROR: Failed to decode OIDC callback request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		loginState, err := db.ConsumeOIDCLoginState(r.Context(), pool, util.HashToken(req.State), providerName)
+		if err != nil {
+			log.Printf("ERROR: Invalid OIDC state from IP %s: %v", util.ClientIP(r), err)
+			http.Error(w, "invalid or expired login attempt", http.StatusBadRequest)
+			return
+		}
+
+		rawIDToken, err := provider.Exchange(r.Context(), req.Code, loginState.CodeVerifier)
+		if err != nil {
+			log.Printf("ERROR: OIDC code exchange failed for provider %s: %v", providerName, err)
+			http.Error(w, "failed to sign in with identity provider", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := provider.VerifyIDToken(r.Context(), rawIDToken, loginState.Nonce)
+		if err != nil {
+			log.Printf("ERROR: OIDC ID token rejected for provider %s: %v", providerName, err)
+			http.Error(w, "failed to sign in with identity provider", http.StatusUnauthorized)
+			return
+		}
+
+		email := strings.ToLower(strings.TrimSpace(claims.Email))
+		if email == "" || !claims.EmailVerified {
+			log.Printf("ERROR: OIDC login without a verified email - Provider: %s, Subject: %s", providerName, claims.Subject)
+			http.Error(w, "your identity provider account must have a verified email", http.StatusForbidden)
+			return
+		}
+
+		user, status, err := resolveOIDCUser(r, pool, providerName, claims, email, loginState.InviteCodeHash)
+		if err != nil {
+			log.Printf("ERROR: OIDC login failed - Provider: %s, Email: %s: %v", providerName, email, err)
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		unlockIfLockoutExpired(r, pool, user)
+		if user.Locked {
+			log.Printf("ERROR: Locked user attempted OIDC login - User: %d", user.ID)
+			recordLoginFailure(r, pool, user, email, "locked")
+			http.Error(w, "User account is locked", http.StatusForbidden)
+			return
+		}
+
+		// The identity is only linked once the login completes, after the second factor for enrolled users
+		identity := &oidcIdentity{Provider: providerName, Subject: claims.Subject, Email: email}
+
+		// The identity provider replaces the password step only; enrolled users still need their second factor
+		if user.TOTPEnabled {
+			mfaToken, err := generateMFAPendingToken(user.ID, identity)
+			if err != nil {
+				log.Printf("ERROR: Failed to generate MFA token for user %s: %v", user.Username, err)
+				http.Error(w, "Error generating token", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"mfa_required": true,
+				"mfa_token":    mfaToken,
+			})
+			return
+		}
+
+		accessToken, refreshToken, err := createSessionTokens(r, pool, user.ID, user.Username, user.SuperAdmin)
+		if err != nil {
+			log.Printf("ERROR: Failed to create session for user %s: %v", user.Username, err)
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+
+		linkOIDCIdentity(r, pool, user.ID, identity)
+		recordLoginSuccess(r, pool, mail, user)
+		if err := db.UpdateUserLastLogin(pool, user.ID); err != nil {
+			log.Printf("ERROR: Failed to update last_login for user %s: %v", user.Username, err)
+		}
+
+		log.Printf("INFO: Successful OIDC login - Provider: %s, User: %s, ID: %d", providerName, user.Username, user.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokenResponse(accessToken, refreshToken))
+	}
+}
+
+// oidcIdentity is an external identity waiting to be linked to the user it signed in as
+type oidcIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+}
+
+// linkOIDCIdentity links the identity to the user once their login has completed. A failure does not fail the
+// login; the identity is linked again on the next one.
+func linkOIDCIdentity(r *http.Request, pool *pgxpool.Pool, userID int64, identity *oidcIdentity) {
+	if identity == nil {
+		return
+	}
+	if err := db.LinkUserIdentity(r.Context(), pool, userID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		log.Printf("ERROR: Failed to link identity for user %d: %v", userID, err)
+	}
+}
+
+// resolveOIDCUser finds or creates the local user for a verified identity and returns an HTTP status to use on failure.
+func resolveOIDCUser(r *http.Request, pool *pgxpool.Pool, providerName string, claims *oidc.Claims, email string, inviteCodeHash *string) (*models.User, int, error) {
+	userID, err := db.GetUserIDByIdentity(r.Context(), pool, providerName, claims.Subject)
+	if err == nil {
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("internal error")
+		}
+		return user, 0, nil
+	}
+	if !errors.Is(err, db.ErrIdentityNotFound) {
+		return nil, http.StatusInternalServerError, errors.New("internal error")
+	}
+
+	if user, err := db.GetUserByEmail(email, pool); err == nil {
+		if status, err := checkOIDCEmailLink(user); err != nil {
+			return nil, status, err
+		}
+		return user, 0, nil
+	}
+
+	// New user: the account has no usable password until the user sets one through a password reset
+	randomPassword, err := util.GenerateRandomToken(32)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("internal error")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.New("internal error")
+	}
+
+	codeHash := ""
+	if inviteCodeHash != nil {
+		codeHash = *inviteCodeHash
+	}
+
+	req := models.RegisterRequest{
+		Email:     email,
+		FirstName: claims.GivenName,
+		LastName:  claims.FamilyName,
+	}
+	// A clash on the generated username is retried with a fresh suffix
+	for attempt := 0; attempt < 3; attempt++ {
+		req.Username, err = usernameFromEmail(email)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("internal error")
+		}
+
+		resp, err := db.RegisterWithInvitation(r.Context(), pool, req, string(hashedPassword), codeHash)
+		if errors.Is(err, db.ErrInvitationInvalid) {
+			return nil, http.StatusForbidden, errors.New("registration is restricted to invited emails")
+		}
+		if err != nil && strings.Contains(err.Error(), "duplicate key") {
+			continue
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("internal error")
+		}
+
+		log.Printf("INFO: Successful OIDC registration - Provider: %s, User: %s, ID: %d", providerName, resp.Username, resp.ID)
+
+		// The provider has already verified the address
+		if err := db.MarkEmailVerified(r.Context(), pool, int64(resp.ID), email); err != nil {
+			log.Printf("ERROR: Failed to mark email verified for user %d: %v", resp.ID, err)
+		}
+		user, err := db.GetUserByID(resp.ID, pool)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("internal error")
+		}
+		return user, 0, nil
+	}
+	return nil, http.StatusConflict, errors.New("could not pick a unique username")
+}
+
+// checkOIDCEmailLink decides whether a new identity may be linked to the existing user with the same email.
+// Only a verified local address may be taken over, otherwise whoever registered it first would gain the identity.
+func checkOIDCEmailLink(user *models.User) (int, error) {
+	if user.EmailVerifiedAt == nil {
+		return http.StatusConflict, errors.New("an account with this email exists but is not verified, sign in with your password and verify it first")
+	}
+	return 0, nil
+}
+
+// usernameFromEmail derives a valid username from the email's local part plus a random suffix.
+func usernameFromEmail(email string) (string, error) {
+	local, _, _ := strings.Cut(email, "@")
+	base := usernameUnsafeChars.ReplaceAllString(strings.ToLower(local), "")
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	suffix, err := util.GenerateRandomToken(3)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + strings.ToLower(usernameUnsafeChars.ReplaceAllString(suffix, "")), nil
+}
+
+func GetUserIdentities(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		identities, err := db.GetIdentitiesForUser(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get identities for user %d: %v", userID, err)
+			http.Error(w, "failed to get identities", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(identities)
+	}
+}
+
+func UnlinkUserIdentity(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		idStr := chi.URLParam(r, "identity_id")
+		identityID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Invalid identity id param for unlink: %s", idStr)
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+
+		err = db.UnlinkUserIdentity(r.Context(), pool, userID, identityID)
+		if err != nil {
+			log.Printf("ERROR: Failed to unlink identity %d for user %d: %v", identityID, userID, err)
+			http.Error(w, "identity not found", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("INFO: User %d unlinked identity %d", userID, identityID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
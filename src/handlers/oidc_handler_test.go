@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"budgee-server/src/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCheckOIDCEmailLinkRejectsUnverifiedLocalEmail(t *testing.T) {
+	user := &models.User{ID: 1, Email: "user@example.com"}
+	status, err := checkOIDCEmailLink(user)
+	if err == nil {
+		t.Fatal("identity was linked to an account whose email is not verified")
+	}
+	if status != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", status, http.StatusConflict)
+	}
+
+	verifiedAt := time.Now()
+	user.EmailVerifiedAt = &verifiedAt
+	if _, err := checkOIDCEmailLink(user); err != nil {
+		t.Fatalf("identity was not linked to an account with a verified email: %v", err)
+	}
+}
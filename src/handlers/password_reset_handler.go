@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const passwordResetTokenTTL = time.Hour
+
+func RequestPasswordReset(pool *pgxpool.Pool, mail mailer.Mailer, appBaseURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Printf("ERROR: Failed to decode password reset request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		// Always respond the same way so the endpoint cannot be used to discover registered emails
+		response := map[string]string{
+			"message": "if an account exists for that email, a reset link has been sent",
+		}
+
+		email := strings.ToLower(strings.TrimSpace(req.Email))
+		user, err := db.GetUserByEmail(email, pool)
+		if err != nil {
+			log.Printf("INFO: Password reset requested for unknown email %s from IP %s", email, util.ClientIP(r))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		if user.Locked {
+			log.Printf("INFO: Password reset requested for locked user %d, ignoring", user.ID)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		// Issue and send the token outside the request so response timing does not reveal whether the email exists
+		go issuePasswordResetToken(pool, mail, appBaseURL, *user)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// issuePasswordResetToken stores a new reset token for the user and emails them the link. It runs after the
+// response has been sent, so failures are only logged.
+func issuePasswordResetToken(pool *pgxpool.Pool, mail mailer.Mailer, appBaseURL string, user models.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := util.GenerateRandomToken(32)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate password reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	err = db.CreatePasswordResetToken(ctx, pool, user.ID, util.HashToken(token), passwordResetTokenTTL)
+	if err != nil {
+		log.Printf("ERROR: Failed to store password reset token for user %d: %v", user.ID, err)
+		return
+	}
+	log.Printf("INFO: Password reset token issued - User: %d", user.ID)
+
+	link := strings.TrimRight(appBaseURL, "/") + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf(
+		"Hi %s,\n\nWe received a request to reset your Budgee password. Use the link below within the next hour to choose a new one:\n\n%s\n\nIf you did not request this, you can ignore this email.\n",
+		user.FirstName, link,
+	)
+	if err := mail.Send(ctx, user.Email, "Reset your Budgee password", body); err != nil {
+		log.Printf("ERROR: Failed to send password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+func ConfirmPasswordReset(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token       string `json:"token"`
+			NewPassword string `json:"new_password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+			log.Printf("ERROR: Failed to decode password reset confirm request body: %v", err)
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if !util.ValidatePassword(req.NewPassword) {
+			log.Printf("ERROR: Password validation failed during password reset")
+			http.Error(w, "password must be at least 8 characters with uppercase, lowercase, digit, and special character", http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			log.Printf("ERROR: Failed to hash new password during password reset: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, err := db.ResetPasswordWithToken(r.Context(), pool, util.HashToken(req.Token), string(hashedPassword))
+		if err != nil {
+			if errors.Is(err, db.ErrInvalidResetToken) {
+				log.Printf("ERROR: Invalid or expired password reset token presented from IP %s", util.ClientIP(r))
+				http.Error(w, "invalid or expired reset token", http.StatusBadRequest)
+				return
+			}
+			log.Printf("ERROR: Failed to reset password: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// Anyone holding an old session loses it once the password is reset
+		if _, err := db.RevokeAllSessionsForUser(r.Context(), pool, userID); err != nil {
+			log.Printf("ERROR: Failed to revoke sessions after password reset for user %d: %v", userID, err)
+		}
+
+		log.Printf("INFO: Password reset completed - User: %d", userID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "password has been reset",
+		})
+	}
+}
@@ -2,19 +2,23 @@ package handlers
 
 import (
 	db "budgee-server/src/db/sql"
+	"budgee-server/src/jobs"
 	"budgee-server/src/models"
 	"budgee-server/src/util"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/plaid/plaid-go/v41/plaid"
 )
@@ -39,6 +43,8 @@ func CreateLinkToken(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Hand
 		)
 		request.SetUser(user)
 		request.SetProducts([]plaid.Products{plaid.PRODUCTS_TRANSACTIONS})
+		// Investments and liabilities are fetched when the institution supports them without blocking institutions that do not
+		request.SetOptionalProducts([]plaid.Products{plaid.PRODUCTS_INVESTMENTS, plaid.PRODUCTS_LIABILITIES})
 		request.SetTransactions(transactions)
 
 		webhookURL := os.Getenv("PLAID_WEBHOOK_URL")
@@ -60,6 +66,123 @@ func CreateLinkToken(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Hand
 	}
 }
 
+// CreateUpdateLinkToken creates a link token in update mode for an existing item, used to re-authenticate a
+// broken connection or, with account_selection_enabled, to share accounts added at the bank since linking.
+func CreateUpdateLinkToken(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+		itemID := chi.URLParam(r, "item_id")
+
+		var req struct {
+			AccountSelectionEnabled bool `json:"account_selection_enabled"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("ERROR: Failed to decode update link token request body: %v", err)
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+		}
+
+		item, err := db.GetPlaidItemForUser(r.Context(), pool, userID, itemID)
+		if err != nil {
+			log.Printf("ERROR: Plaid item %s not found for user %d: %v", itemID, userID, err)
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+
+		request := plaid.NewLinkTokenCreateRequest(
+			"Budgee",
+			"en",
+			[]plaid.CountryCode{plaid.COUNTRYCODE_US},
+		)
+		request.SetUser(plaid.LinkTokenCreateRequestUser{
+			ClientUserId: strconv.FormatInt(userID, 10),
+		})
+		// Update mode is selected by passing the access token instead of products
+		request.SetAccessToken(item.AccessToken)
+		if req.AccountSelectionEnabled {
+			request.SetUpdate(plaid.LinkTokenCreateRequestUpdate{
+				AccountSelectionEnabled: &req.AccountSelectionEnabled,
+			})
+		}
+
+		webhookURL := os.Getenv("PLAID_WEBHOOK_URL")
+		if webhookURL != "" {
+			request.SetWebhook(webhookURL)
+		}
+
+		resp, _, err := plaidClient.PlaidApi.LinkTokenCreate(r.Context()).LinkTokenCreateRequest(*request).Execute()
+		if err != nil {
+			http.Error(w, "Failed to create link token", http.StatusInternalServerError)
+			log.Printf("ERROR: Plaid update mode link token creation failed for user %d, item %s: %v", userID, itemID, err)
+			return
+		}
+
+		log.Printf("INFO: Update mode link token created - User: %d, Item: %s, Account selection: %t", userID, itemID, req.AccountSelectionEnabled)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp.GetLinkToken())
+	}
+}
+
+// CompleteItemUpdate is called once the user finishes Link in update mode. The access token does not change,
+// so there is nothing to exchange: the item is marked healthy, newly shared accounts are saved and the
+// transactions that were missed while the connection was broken are synced.
+func CompleteItemUpdate(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+		itemID := chi.URLParam(r, "item_id")
+
+		item, err := db.GetPlaidItemForUser(r.Context(), pool, userID, itemID)
+		if err != nil {
+			log.Printf("ERROR: Plaid item %s not found for user %d: %v", itemID, userID, err)
+			http.Error(w, "item not found", http.StatusNotFound)
+			return
+		}
+
+		if err := db.ClearPlaidItemError(r.Context(), pool, item.ItemID); err != nil {
+			log.Printf("ERROR: Failed to clear error status for item %s: %v", item.ItemID, err)
+			http.Error(w, "Failed to update item", http.StatusInternalServerError)
+			return
+		}
+
+		accountsReq := plaid.NewAccountsGetRequest(item.AccessToken)
+		accountsResp, _, err := plaidClient.PlaidApi.AccountsGet(r.Context()).AccountsGetRequest(*accountsReq).Execute()
+		if err != nil {
+			log.Printf("ERROR: Failed to fetch accounts after update for item %s: %v", item.ItemID, err)
+		} else {
+			if err := db.SaveAccounts(r.Context(), pool, userID, item.ID, accountsResp.GetAccounts()); err != nil {
+				log.Printf("ERROR: Failed to save accounts after update for item %s: %v", item.ItemID, err)
+			}
+			if err := db.SetPlaidItemNewAccountsAvailable(r.Context(), pool, item.ItemID, false); err != nil {
+				log.Printf("ERROR: Failed to reset new accounts flag for item %s: %v", item.ItemID, err)
+			}
+		}
+
+		if _, err := SyncTransactionsForItem(r.Context(), pool, plaidClient, item); err != nil {
+			log.Printf("ERROR: Failed to sync transactions after update for item %s: %v", item.ItemID, err)
+
+			// The repair did not take, put the item back into its error state
+			if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && plaidErr.ErrorCode != "" {
+				if err := db.SetPlaidItemError(r.Context(), pool, item.ItemID, models.ItemStatusError, plaidErr.ErrorCode, plaidErr.ErrorMessage); err != nil {
+					log.Printf("ERROR: Failed to record error status for item %s: %v", item.ItemID, err)
+				}
+			}
+			http.Error(w, "Failed to sync transactions", http.StatusBadGateway)
+			return
+		}
+
+		log.Printf("INFO: Plaid item update completed - User: %d, Item: %s", userID, item.ItemID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "item updated",
+		})
+	}
+}
+
 func ExchangePublicToken(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value("user_id").(int64)
@@ -113,11 +236,18 @@ func ExchangePublicToken(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.
 
 		log.Printf("INFO: Successfully exchanged public token and saved plaid item for user %d, item %s", userID, itemID)
 
+		// Plaid only sends DEFAULT_UPDATE webhooks when these change, so fetch them once now. The jobs wait until
+		// the frontend has saved the item's accounts and do nothing for institutions without the product.
+		for _, kind := range productSyncJobKinds {
+			if _, err := EnqueueProductSync(r.Context(), pool, kind, itemID); err != nil {
+				log.Printf("ERROR: Failed to queue %s job for item %s: %v", kind, itemID, err)
+			}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(map[string]string{
-			"item_id":      itemID,
-			"access_token": accessToken,
+			"item_id": itemID,
 		})
 	}
 }
@@ -129,16 +259,14 @@ func GetPlaidAccounts(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Han
 
 		log.Println("Fetching accounts for user:", userID, "item:", itemID)
 
-		query := `SELECT access_token FROM plaid_items WHERE user_id = $1 AND id = $2`
-		var accessToken string
-		err := pool.QueryRow(r.Context(), query, userID, itemID).Scan(&accessToken)
+		item, err := db.GetPlaidItemForUser(r.Context(), pool, userID, itemID)
 		if err != nil {
 			http.Error(w, "Access token not found", http.StatusNotFound)
 			log.Printf("ERROR: Failed to get access token for user %d, item %s: %v", userID, itemID, err)
 			return
 		}
 
-		request := plaid.NewAccountsGetRequest(accessToken)
+		request := plaid.NewAccountsGetRequest(item.AccessToken)
 		accountsResp, _, err := plaidClient.PlaidApi.AccountsGet(context.Background()).AccountsGetRequest(*request).Execute()
 		if err != nil {
 			http.Error(w, "Failed to fetch accounts from Plaid", http.StatusInternalServerError)
@@ -163,88 +291,22 @@ func SyncTransactions(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Han
 		userID := r.Context().Value("user_id").(int64)
 		itemID := chi.URLParam(r, "item_id")
 
-		query := `SELECT id, access_token FROM plaid_items WHERE user_id = $1 AND id = $2`
-		var dbItemID int64
-		var accessToken string
-		err := pool.QueryRow(r.Context(), query, userID, itemID).Scan(&dbItemID, &accessToken)
+		item, err := db.GetPlaidItemForUser(r.Context(), pool, userID, itemID)
 		if err != nil {
 			http.Error(w, "Access token not found", http.StatusNotFound)
 			log.Printf("ERROR: Failed to get access token for user %d, item %s: %v", userID, itemID, err)
 			return
 		}
 
-		cursor, err := db.GetSyncCursor(r.Context(), pool, dbItemID)
-		if err != nil {
-			http.Error(w, "Failed to retrieve sync cursor", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to get sync cursor for item %d: %v", dbItemID, err)
-			return
-		}
-
-		hasMore := true
-		var allAdded []plaid.Transaction
-		var allModified []plaid.Transaction
-		var allRemoved []plaid.RemovedTransaction
-
-		for hasMore {
-			request := plaid.NewTransactionsSyncRequest(accessToken)
-			if cursor != "" {
-				request.SetCursor(cursor)
-			}
-
-			transactionsResp, _, err := plaidClient.PlaidApi.TransactionsSync(context.Background()).TransactionsSyncRequest(*request).Execute()
-			if err != nil {
-				http.Error(w, "Failed to fetch transactions", http.StatusInternalServerError)
-				log.Printf("ERROR: Failed to sync transactions for user %d, item %d: %v", userID, dbItemID, err)
-				return
-			}
-
-			allAdded = append(allAdded, transactionsResp.GetAdded()...)
-			allModified = append(allModified, transactionsResp.GetModified()...)
-			allRemoved = append(allRemoved, transactionsResp.GetRemoved()...)
-
-			hasMore = transactionsResp.GetHasMore()
-			cursor = transactionsResp.GetNextCursor()
-		}
-
-		// Save added transactions
-		err = db.SaveTransactions(r.Context(), pool, userID, allAdded)
+		result, err := SyncTransactionsForItem(r.Context(), pool, plaidClient, item)
 		if err != nil {
-			http.Error(w, "Failed to save transactions", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to save transactions for user %d: %v", userID, err)
+			http.Error(w, "Failed to sync transactions", http.StatusInternalServerError)
+			log.Printf("ERROR: Failed to sync transactions for user %d, item %s: %v", userID, itemID, err)
 			return
 		}
 
-		// Update modified transactions
-		err = db.UpdateTransactions(r.Context(), pool, userID, allModified)
-		if err != nil {
-			http.Error(w, "Failed to update transactions", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to update transactions for user %d: %v", userID, err)
-			return
-		}
-
-		// Remove deleted transactions
-		err = db.RemoveTransactions(r.Context(), pool, userID, allRemoved)
-		if err != nil {
-			http.Error(w, "Failed to remove transactions", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to remove transactions for user %d: %v", userID, err)
-			return
-		}
-
-		err = db.UpdateSyncCursor(r.Context(), pool, dbItemID, cursor)
-		if err != nil {
-			http.Error(w, "Failed to update sync cursor", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to update sync cursor for item %d: %v", dbItemID, err)
-			return
-		}
-
-		log.Printf("INFO: Successfully synced transactions for user %d, item %d - Added: %d, Modified: %d, Removed: %d", userID, dbItemID, len(allAdded), len(allModified), len(allRemoved))
-
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"added":    len(allAdded),
-			"modified": len(allModified),
-			"removed":  len(allRemoved),
-		})
+		json.NewEncoder(w).Encode(result)
 	}
 }
 
@@ -267,17 +329,19 @@ func SyncTransactionsForUser(plaidClient *plaid.APIClient, pool *pgxpool.Pool) h
 		}
 
 		type syncResult struct {
-			ItemID  string `json:"item_id"`
-			Success bool   `json:"success"`
-			Error   string `json:"error,omitempty"`
+			ItemID  string                 `json:"item_id"`
+			Success bool                   `json:"success"`
+			Error   string                 `json:"error,omitempty"`
+			Result  *TransactionSyncResult `json:"result,omitempty"`
 		}
 		var results []syncResult
 
 		for _, item := range items {
-			err := SyncTransactionsForItem(r.Context(), pool, plaidClient, &item)
+			result, err := SyncTransactionsForItem(r.Context(), pool, plaidClient, &item)
 			res := syncResult{
 				ItemID:  item.ID,
 				Success: err == nil,
+				Result:  result,
 			}
 			if err != nil {
 				res.Error = err.Error()
@@ -293,72 +357,6 @@ func SyncTransactionsForUser(plaidClient *plaid.APIClient, pool *pgxpool.Pool) h
 	}
 }
 
-func SyncTransactionsForItem(ctx context.Context, pool *pgxpool.Pool, plaidClient *plaid.APIClient, item *models.PlaidItem) error {
-	itemIDInt, err := strconv.ParseInt(item.ID, 10, 64)
-	if err != nil {
-		return err
-	}
-
-	cursor, err := db.GetSyncCursor(ctx, pool, itemIDInt)
-	if err != nil {
-		return err
-	}
-
-	hasMore := true
-	options := plaid.NewTransactionsSyncRequestOptions()
-	options.SetIncludePersonalFinanceCategory(true)
-	options.SetPersonalFinanceCategoryVersion(plaid.PERSONALFINANCECATEGORYVERSION_V2)
-
-	var allAdded []plaid.Transaction
-	var allModified []plaid.Transaction
-	var allRemoved []plaid.RemovedTransaction
-
-	for hasMore {
-		request := plaid.NewTransactionsSyncRequest(item.AccessToken)
-		request.SetOptions(*options)
-		if cursor != "" {
-			request.SetCursor(cursor)
-		}
-		transactionsResp, _, err := plaidClient.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*request).Execute()
-		if err != nil {
-			return err
-		}
-		allAdded = append(allAdded, transactionsResp.GetAdded()...)
-		allModified = append(allModified, transactionsResp.GetModified()...)
-		allRemoved = append(allRemoved, transactionsResp.GetRemoved()...)
-		hasMore = transactionsResp.GetHasMore()
-		cursor = transactionsResp.GetNextCursor()
-	}
-
-	// Save added transactions
-	if err := db.SaveTransactions(ctx, pool, item.UserID, allAdded); err != nil {
-		return err
-	}
-	// Update modified transactions
-	if err := db.UpdateTransactions(ctx, pool, item.UserID, allModified); err != nil {
-		return err
-	}
-	// Remove deleted transactions
-	if err := db.RemoveTransactions(ctx, pool, item.UserID, allRemoved); err != nil {
-		return err
-	}
-	// Update sync cursor
-	if err := db.UpdateSyncCursor(ctx, pool, itemIDInt, cursor); err != nil {
-		return err
-	}
-
-	log.Printf("INFO: Successfully synced transactions for user %d, item %d - Added: %d, Modified: %d, Removed: %d",
-		item.UserID, itemIDInt, len(allAdded), len(allModified), len(allRemoved))
-
-	// Apply transaction rules after syncing
-	_, err = db.ApplyTransactionRulesToUser(ctx, pool, item.UserID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func GetPlaidItemsSQL(pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value("user_id").(int64)
@@ -429,15 +427,14 @@ func DeletePlaidItem(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Hand
 		itemID := chi.URLParam(r, "item_id")
 
 		// Fetch owner and access token
-		query := `SELECT user_id, access_token FROM plaid_items WHERE id = $1`
-		var ownerUserID int64
-		var accessToken string
-		err := pool.QueryRow(r.Context(), query, itemID).Scan(&ownerUserID, &accessToken)
+		item, err := db.GetPlaidItemByID(r.Context(), pool, itemID)
 		if err != nil {
 			http.Error(w, "Item not found", http.StatusNotFound)
 			log.Printf("ERROR: Failed to find plaid item - item_id: %s: %v", itemID, err)
 			return
 		}
+		ownerUserID := item.UserID
+		accessToken := item.AccessToken
 
 		if userID != ownerUserID {
 			log.Printf("ERROR: Unauthorized plaid item deletion attempt - Authenticated user: %d, Item owner: %d, Item: %s", userID, ownerUserID, itemID)
@@ -477,15 +474,19 @@ func AdminDeletePlaidItem(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http
 		itemID := chi.URLParam(r, "item_id")
 
 		// Fetch owner and access token
-		query := `SELECT user_id, access_token FROM plaid_items WHERE id = $1`
-		var ownerUserID int64
-		var accessToken string
-		err := pool.QueryRow(r.Context(), query, itemID).Scan(&ownerUserID, &accessToken)
+		item, err := db.GetPlaidItemByID(r.Context(), pool, itemID)
 		if err != nil {
 			http.Error(w, "Item not found", http.StatusNotFound)
 			log.Printf("ERROR: Failed to find plaid item - item_id: %s: %v", itemID, err)
 			return
 		}
+		ownerUserID := item.UserID
+		accessToken := item.AccessToken
+
+		audit := util.Audit(r)
+		audit.Action = "plaid_item.delete"
+		audit.TargetType = "plaid_item"
+		audit.Before = item
 
 		// Remove item from Plaid
 		request := plaid.NewItemRemoveRequest(accessToken)
@@ -623,9 +624,78 @@ func DeleteTransaction(pool *pgxpool.Pool) http.HandlerFunc {
 	}
 }
 
+// ResetTransactionOverrides discards the user's edits to the given fields, or to every field when none are
+// listed, and puts back the values Plaid last reported.
+func ResetTransactionOverrides(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+		transactionIDStr := chi.URLParam(r, "transaction_id")
+		transactionID, err := strconv.Atoi(transactionIDStr)
+		if err != nil {
+			log.Printf("ERROR: Invalid transaction_id: %s", transactionIDStr)
+			http.Error(w, "invalid transaction id", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Fields []string `json:"fields"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				log.Printf("ERROR: Failed to decode reset transaction request body: %v", err)
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+		}
+		if len(req.Fields) == 0 {
+			req.Fields = models.OverridableTransactionFields
+		}
+		for _, field := range req.Fields {
+			if !slices.Contains(models.OverridableTransactionFields, field) {
+				http.Error(w, fmt.Sprintf("unknown field %q", field), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Check ownership and get account_id
+		query := `
+            SELECT t.id, t.account_id FROM transactions t
+            JOIN accounts a ON t.account_id = a.id
+            JOIN plaid_items p ON a.item_id = p.id
+            WHERE t.id = $1 AND p.user_id = $2
+        `
+		var id int
+		var accountID int64
+		err = pool.QueryRow(r.Context(), query, transactionID, userID).Scan(&id, &accountID)
+		if err != nil {
+			log.Printf("ERROR: Transaction not found or forbidden for reset - transaction_id: %d, user_id: %d: %v", transactionID, userID, err)
+			http.Error(w, "transaction not found or forbidden", http.StatusForbidden)
+			return
+		}
+
+		err = db.ResetTransactionOverrides(r.Context(), pool, transactionID, req.Fields, userID, accountID)
+		if err != nil {
+			log.Printf("ERROR: Failed to reset transaction - transaction_id: %d, user_id: %d: %v", transactionID, userID, err)
+			http.Error(w, "failed to reset transaction", http.StatusInternalServerError)
+			return
+		}
+
+		err = db.RecategorizeTransaction(r.Context(), pool, transactionID, int(userID), int(accountID))
+		if err != nil {
+			log.Printf("ERROR: Failed to recategorize transaction after reset - transaction_id: %d, user_id: %d: %v", transactionID, userID, err)
+			http.Error(w, "failed to recategorize transaction", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "transaction reset"})
+	}
+}
+
 func PlaidWebhook(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
+			WebhookType string `json:"webhook_type"`
 			WebhookCode string `json:"webhook_code"`
 			ItemID      string `json:"item_id"`
 		}
@@ -661,13 +731,47 @@ func PlaidWebhook(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Handler
 			return
 		}
 
-		switch req.WebhookCode {
-		case "SYNC_UPDATES_AVAILABLE":
+		switch {
+		case req.WebhookCode == "SYNC_UPDATES_AVAILABLE":
 			log.Printf("INFO: Received Plaid webhook to sync transactions - Item: %s, Webhook Code: %s", req.ItemID, req.WebhookCode)
 
-			// Trigger async in goroutine to ensure quick 200 response to Plaid
-			go TriggerTransactionSyncFromWebhook(plaidClient, pool, req.ItemID)
+			// The sync runs on the job queue so Plaid gets a quick 200 and failures are retried
+			jobID, err := EnqueueItemSync(r.Context(), pool, req.ItemID)
+			if err != nil {
+				log.Printf("ERROR: Failed to queue sync for item %s: %v", req.ItemID, err)
+				http.Error(w, "failed to process webhook", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("INFO: Queued sync job %d for item %s", jobID, req.ItemID)
 
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+			return
+		case productSyncJobKinds[req.WebhookType] != "" && req.WebhookCode == "DEFAULT_UPDATE":
+			// DEFAULT_UPDATE is sent for several products, the webhook type says which data changed
+			kind := productSyncJobKinds[req.WebhookType]
+			log.Printf("INFO: Received Plaid %s webhook - Item: %s", req.WebhookType, req.ItemID)
+
+			jobID, err := EnqueueProductSync(r.Context(), pool, kind, req.ItemID)
+			if err != nil {
+				log.Printf("ERROR: Failed to queue %s job for item %s: %v", kind, req.ItemID, err)
+				http.Error(w, "failed to process webhook", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("INFO: Queued %s job %d for item %s", kind, jobID, req.ItemID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "received"})
+			return
+		case req.WebhookType == "ITEM":
+			// Status updates are quick, so they are applied before answering and a failure lets Plaid retry
+			if err := handleItemWebhook(r.Context(), pool, bodyBytes); err != nil && !errors.Is(err, db.ErrPlaidItemNotFound) {
+				log.Printf("ERROR: Failed to handle Plaid item webhook - Item: %s, Webhook Code: %s: %v", req.ItemID, req.WebhookCode, err)
+				http.Error(w, "failed to process webhook", http.StatusInternalServerError)
+				return
+			}
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"status": "received"})
@@ -681,32 +785,131 @@ func PlaidWebhook(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Handler
 	}
 }
 
-func TriggerTransactionSyncFromWebhook(plaidClient *plaid.APIClient, pool *pgxpool.Pool, itemID string) {
-	// Get item from db using itemID lookup
-	item, err := db.GetPlaidItemByItemID(context.Background(), pool, itemID)
-	if err != nil {
-		log.Printf("ERROR: From Webhook: Failed to fetch item for item_id %s: %v", itemID, err)
-		return
+const syncItemJobMaxAttempts = 8
+
+// userActionErrorCodes are Plaid errors that retrying cannot fix until the user repairs the item in Link
+var userActionErrorCodes = map[string]bool{
+	"ITEM_LOGIN_REQUIRED": true,
+	"ACCESS_NOT_GRANTED":  true,
+	"NO_ACCOUNTS":         true,
+}
+
+// EnqueueItemSync queues a transaction sync for the item. Requests for an item that already has a sync
+// waiting are merged into it.
+func EnqueueItemSync(ctx context.Context, pool *pgxpool.Pool, itemID string) (int64, error) {
+	return db.EnqueueJob(ctx, pool, models.JobKindSyncItem, itemID, models.SyncItemPayload{ItemID: itemID}, syncItemJobMaxAttempts)
+}
+
+// Plaid error codes meaning the item does not have the product's data. Retrying will not change that.
+var productUnavailableCodes = map[string]bool{
+	"PRODUCTS_NOT_SUPPORTED":      true,
+	"ADDITIONAL_CONSENT_REQUIRED": true,
+	"NO_INVESTMENT_ACCOUNTS":      true,
+	"NO_INVESTMENT_AUTH":          true,
+	"NO_LIABILITY_ACCOUNTS":       true,
+}
+
+// productSyncJobKinds maps the webhook types of Plaid's optional products to the job that refreshes their data
+var productSyncJobKinds = map[string]string{
+	"HOLDINGS":                 models.JobKindSyncHoldings,
+	"INVESTMENTS_TRANSACTIONS": models.JobKindSyncInvestmentTransactions,
+	"LIABILITIES":              models.JobKindSyncLiabilities,
+}
+
+// EnqueueProductSync queues a refresh of one of the item's optional products, such as its holdings or
+// liabilities, merged into any refresh of the same kind that is still waiting.
+func EnqueueProductSync(ctx context.Context, pool *pgxpool.Pool, kind string, itemID string) (int64, error) {
+	return db.EnqueueJob(ctx, pool, kind, itemID, models.SyncItemPayload{ItemID: itemID}, syncItemJobMaxAttempts)
+}
+
+// productJobItem loads the item an optional product job is for. It returns nil without an error when the item
+// has been deleted since the job was queued, and an error while its accounts have not been saved yet so the
+// job is retried once they have.
+func productJobItem(ctx context.Context, pool *pgxpool.Pool, job *models.Job) (*models.PlaidItem, error) {
+	var payload models.SyncItemPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("invalid %s job payload: %w", job.Kind, err)
 	}
-	err = SyncTransactionsForItem(context.Background(), pool, plaidClient, item)
+
+	item, err := db.GetPlaidItemByItemID(ctx, pool, payload.ItemID)
 	if err != nil {
-		log.Printf("ERROR: From Webhook: Failed to sync transactions for item %s: %v", itemID, err)
-	} else {
-		log.Printf("INFO: From Webhook: Successfully synced transactions for item %s", itemID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("INFO: Item %s no longer exists, skipping %s", payload.ItemID, job.Kind)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch item %s: %w", payload.ItemID, err)
 	}
 
-	err = db.RecategorizeTransactions(context.Background(), pool)
+	accounts, err := db.GetAccountsForItemSQL(ctx, pool, item.ItemID)
 	if err != nil {
-		log.Printf("ERROR: From Webhook: Failed to recategorize transactions after sync for item %s: %v", itemID, err)
-	} else {
-		log.Printf("INFO: From Webhook: Successfully recategorized transactions after sync for item %s", itemID)
+		return nil, fmt.Errorf("failed to fetch accounts for item %s: %w", item.ItemID, err)
 	}
-	// After transaction sync and recategorization, update account balances
-	err = UpdateAccountBalances(context.Background(), plaidClient, pool, itemID)
-	if err != nil {
-		log.Printf("ERROR: From Webhook: Failed to update account balances for item %s: %v", itemID, err)
-	} else {
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("accounts for item %s have not been saved yet", item.ItemID)
+	}
+	return item, nil
+}
+
+// handleProductFetchError decides whether a failed optional product call is worth retrying. Items without the
+// product's data and items that need the user to log in again are not.
+func handleProductFetchError(ctx context.Context, pool *pgxpool.Pool, item *models.PlaidItem, err error) error {
+	plaidErr, convErr := plaid.ToPlaidError(err)
+	if convErr != nil {
+		return fmt.Errorf("plaid request failed for item %s: %w", item.ItemID, err)
+	}
+	if productUnavailableCodes[plaidErr.ErrorCode] {
+		log.Printf("INFO: Item %s does not have this product's data (%s), skipping", item.ItemID, plaidErr.ErrorCode)
+		return nil
+	}
+	if userActionErrorCodes[plaidErr.ErrorCode] {
+		log.Printf("INFO: Item %s needs user action (%s), not retrying", item.ItemID, plaidErr.ErrorCode)
+		return db.SetPlaidItemError(ctx, pool, item.ItemID, models.ItemStatusError, plaidErr.ErrorCode, plaidErr.ErrorMessage)
+	}
+	return fmt.Errorf("plaid request failed for item %s: %w", item.ItemID, err)
+}
+
+// SyncItemJob handles JobKindSyncItem jobs: it syncs the item's transactions, reapplies categories and
+// refreshes account balances. Items that were deleted or need the user to re-authenticate are not retried.
+func SyncItemJob(plaidClient *plaid.APIClient, pool *pgxpool.Pool) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var payload models.SyncItemPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid sync job payload: %w", err)
+		}
+		itemID := payload.ItemID
+
+		item, err := db.GetPlaidItemByItemID(ctx, pool, itemID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				log.Printf("INFO: From Webhook: Item %s no longer exists, skipping sync", itemID)
+				return nil
+			}
+			return fmt.Errorf("failed to fetch item %s: %w", itemID, err)
+		}
+
+		// Syncs of one item that overlap fail with ErrItemSyncInProgress or ErrSyncCursorMoved when applying their
+		// changes, and the retry picks up whatever the other sync left behind
+		_, err = SyncTransactionsForItem(ctx, pool, plaidClient, item)
+		if err != nil {
+			if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && userActionErrorCodes[plaidErr.ErrorCode] {
+				log.Printf("INFO: From Webhook: Item %s needs user action (%s), not retrying", itemID, plaidErr.ErrorCode)
+				return db.SetPlaidItemError(ctx, pool, itemID, models.ItemStatusError, plaidErr.ErrorCode, plaidErr.ErrorMessage)
+			}
+			return fmt.Errorf("failed to sync transactions for item %s: %w", itemID, err)
+		}
+		log.Printf("INFO: From Webhook: Successfully synced transactions for item %s", itemID)
+
+		if err := db.RecategorizeTransactions(ctx, pool); err != nil {
+			return fmt.Errorf("failed to recategorize transactions after sync for item %s: %w", itemID, err)
+		}
+		log.Printf("INFO: From Webhook: Successfully recategorized transactions after sync for item %s", itemID)
+
+		// After transaction sync and recategorization, update account balances
+		if err := UpdateAccountBalances(ctx, plaidClient, pool, itemID); err != nil {
+			return fmt.Errorf("failed to update account balances for item %s: %w", itemID, err)
+		}
 		log.Printf("INFO: From Webhook: Successfully updated account balances for item %s", itemID)
+		return nil
 	}
 }
 
@@ -718,12 +921,11 @@ func UpdateAccountBalances(ctx context.Context, plaidClient *plaid.APIClient, po
 	}
 
 	// 2. Get all accounts for the itemID from Plaid
-	var accessToken string
-	err = pool.QueryRow(ctx, "SELECT access_token FROM plaid_items WHERE item_id = $1", itemID).Scan(&accessToken)
+	item, err := db.GetPlaidItemByItemID(ctx, pool, itemID)
 	if err != nil {
 		return err
 	}
-	request := plaid.NewAccountsGetRequest(accessToken)
+	request := plaid.NewAccountsGetRequest(item.AccessToken)
 	accountsResp, _, err := plaidClient.PlaidApi.AccountsGet(ctx).AccountsGetRequest(*request).Execute()
 	if err != nil {
 		return err
@@ -784,13 +986,13 @@ func FireSandboxWebhook(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.H
 		}
 
 		// Look up the access token for the given item_id
-		var accessToken string
-		err := pool.QueryRow(r.Context(), "SELECT access_token FROM plaid_items WHERE item_id = $1", req.ItemID).Scan(&accessToken)
+		item, err := db.GetPlaidItemByItemID(r.Context(), pool, req.ItemID)
 		if err != nil {
 			log.Printf("ERROR: Failed to find access token for item_id %s: %v", req.ItemID, err)
 			http.Error(w, "item not found", http.StatusNotFound)
 			return
 		}
+		accessToken := item.AccessToken
 
 		fireReq := plaid.NewSandboxItemFireWebhookRequest(accessToken, req.WebhookCode)
 		_, _, err = plaidClient.PlaidApi.SandboxItemFireWebhook(r.Context()).SandboxItemFireWebhookRequest(*fireReq).Execute()
@@ -838,13 +1040,13 @@ func UpdateItemWebhook(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.Ha
 		}
 
 		// Look up the access token for the given item_id
-		var accessToken string
-		err := pool.QueryRow(r.Context(), "SELECT access_token FROM plaid_items WHERE item_id = $1", req.ItemID).Scan(&accessToken)
+		item, err := db.GetPlaidItemByItemID(r.Context(), pool, req.ItemID)
 		if err != nil {
 			log.Printf("ERROR: Failed to find access token for item_id %s: %v", req.ItemID, err)
 			http.Error(w, "item not found", http.StatusNotFound)
 			return
 		}
+		accessToken := item.AccessToken
 
 		request := plaid.NewItemWebhookUpdateRequest(accessToken)
 		request.SetWebhook(req.WebhookURL)
@@ -944,34 +1146,12 @@ func UpdateAllItemWebhooks(plaidClient *plaid.APIClient, pool *pgxpool.Pool) htt
 		}
 
 		// Get all plaid items from the database
-		rows, err := pool.Query(r.Context(), "SELECT item_id, access_token FROM plaid_items")
+		items, err := db.GetAllPlaidItems(r.Context(), pool)
 		if err != nil {
 			log.Printf("ERROR: Failed to fetch plaid items: %v", err)
 			http.Error(w, "failed to fetch items", http.StatusInternalServerError)
 			return
 		}
-		defer rows.Close()
-
-		type itemInfo struct {
-			ItemID      string
-			AccessToken string
-		}
-
-		var items []itemInfo
-		for rows.Next() {
-			var item itemInfo
-			if err := rows.Scan(&item.ItemID, &item.AccessToken); err != nil {
-				log.Printf("ERROR: Failed to scan item row: %v", err)
-				continue
-			}
-			items = append(items, item)
-		}
-
-		if err := rows.Err(); err != nil {
-			log.Printf("ERROR: Error iterating plaid items: %v", err)
-			http.Error(w, "failed to fetch items", http.StatusInternalServerError)
-			return
-		}
 
 		// Update webhook for each item
 		successCount := 0
@@ -1003,6 +1183,12 @@ func UpdateAllItemWebhooks(plaidClient *plaid.APIClient, pool *pgxpool.Pool) htt
 			response["failed_items"] = errors
 		}
 
+		audit := util.Audit(r)
+		audit.Action = "plaid_item.webhook.update_all"
+		audit.TargetType = "plaid_item"
+		audit.TargetID = "*"
+		audit.After = response
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
@@ -1025,95 +1211,32 @@ func SyncTransactionsSandbox(plaidClient *plaid.APIClient, pool *pgxpool.Pool) h
 			return
 		}
 
-		query := `SELECT id, access_token, user_id FROM plaid_items WHERE id = $1`
-		var dbItemID int64
-		var accessToken string
-		var userID int64
-		err := pool.QueryRow(r.Context(), query, itemID).Scan(&dbItemID, &accessToken, &userID)
+		item, err := db.GetPlaidItemByID(r.Context(), pool, itemID)
 		if err != nil {
 			http.Error(w, "Access token not found", http.StatusNotFound)
 			log.Printf("ERROR: Failed to get access token for item %s: %v", itemID, err)
 			return
 		}
 
-		cursor, err := db.GetSyncCursor(r.Context(), pool, dbItemID)
+		result, err := SyncTransactionsForItem(r.Context(), pool, plaidClient, item)
 		if err != nil {
-			http.Error(w, "Failed to retrieve sync cursor", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to get sync cursor for item %d: %v", dbItemID, err)
+			http.Error(w, "Failed to sync transactions", http.StatusInternalServerError)
+			log.Printf("ERROR: Failed to sync transactions for item %s: %v", itemID, err)
 			return
 		}
 
-		hasMore := true
-		var allAdded []plaid.Transaction
-		var allModified []plaid.Transaction
-		var allRemoved []plaid.RemovedTransaction
-
-		for hasMore {
-			request := plaid.NewTransactionsSyncRequest(accessToken)
-			if cursor != "" {
-				request.SetCursor(cursor)
-			}
-
-			transactionsResp, _, err := plaidClient.PlaidApi.TransactionsSync(context.Background()).TransactionsSyncRequest(*request).Execute()
-			if err != nil {
-				http.Error(w, "Failed to fetch transactions", http.StatusInternalServerError)
-				log.Printf("ERROR: Failed to sync transactions for item %d: %v", dbItemID, err)
-				return
-			}
-
-			allAdded = append(allAdded, transactionsResp.GetAdded()...)
-			allModified = append(allModified, transactionsResp.GetModified()...)
-			allRemoved = append(allRemoved, transactionsResp.GetRemoved()...)
-
-			hasMore = transactionsResp.GetHasMore()
-			cursor = transactionsResp.GetNextCursor()
-		}
-
-		// Save added transactions
-		err = db.SaveTransactions(r.Context(), pool, userID, allAdded)
-		if err != nil {
-			http.Error(w, "Failed to save transactions", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to save transactions for item %d: %v", dbItemID, err)
-			return
-		}
-
-		// Update modified transactions
-		err = db.UpdateTransactions(r.Context(), pool, userID, allModified)
-		if err != nil {
-			http.Error(w, "Failed to update transactions", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to update transactions for item %d: %v", dbItemID, err)
-			return
-		}
-
-		// Remove deleted transactions
-		err = db.RemoveTransactions(r.Context(), pool, userID, allRemoved)
-		if err != nil {
-			http.Error(w, "Failed to remove transactions", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to remove transactions for item %d: %v", dbItemID, err)
-			return
-		}
-
-		err = db.UpdateSyncCursor(r.Context(), pool, dbItemID, cursor)
-		if err != nil {
-			http.Error(w, "Failed to update sync cursor", http.StatusInternalServerError)
-			log.Printf("ERROR: Failed to update sync cursor for item %d: %v", dbItemID, err)
-			return
-		}
-
-		log.Printf("INFO: Successfully synced transactions for item %d - Added: %d, Modified: %d, Removed: %d", dbItemID, len(allAdded), len(allModified), len(allRemoved))
-
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"added":    len(allAdded),
-			"modified": len(allModified),
-			"removed":  len(allRemoved),
-		})
+		json.NewEncoder(w).Encode(result)
 	}
 }
 
 func ClearCache(pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cacheName := chi.URLParam(r, "cache_name")
+		audit := util.Audit(r)
+		audit.Action = "cache.clear"
+		audit.TargetType = "cache"
+		audit.TargetID = cacheName
 		err := db.ClearCache(r.Context(), pool, cacheName)
 		if err != nil {
 			http.Error(w, "Failed to clear cache", http.StatusInternalServerError)
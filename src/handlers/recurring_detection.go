@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"budgee-server/src/models"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+const (
+	// Long enough to see an annual charge twice
+	recurringHistoryDays = 800
+	// Amounts within this share of the smallest amount in a group, or within recurringAmountToleranceMin, are
+	// treated as the same stream so a stream survives small price changes and varying bills
+	recurringAmountTolerance    = 0.25
+	recurringAmountToleranceMin = 2.0
+	// Share of the intervals between charges that must fit the cadence
+	recurringRegularity = 0.66
+	// Merchant names are shortened to this many words so store numbers and reference suffixes do not split them
+	recurringMerchantWords = 3
+)
+
+// recurringCadence is a cadence detection recognizes, by the number of days between charges
+type recurringCadence struct {
+	frequency      string
+	minDays        int
+	maxDays        int
+	minOccurrences int
+}
+
+// Semi-monthly streams cannot be told apart from biweekly ones by their intervals alone, so only Plaid reports them
+var recurringCadences = []recurringCadence{
+	{models.RecurringFrequencyWeekly, 6, 8, 3},
+	{models.RecurringFrequencyBiweekly, 12, 16, 3},
+	{models.RecurringFrequencyMonthly, 26, 35, 3},
+	{models.RecurringFrequencyQuarterly, 84, 98, 3},
+	{models.RecurringFrequencyAnnually, 350, 380, 2},
+}
+
+// Nominal length of each frequency in days, used for the grace period before a stream counts as cancelled
+var recurringFrequencyDays = map[string]int{
+	models.RecurringFrequencyWeekly:      7,
+	models.RecurringFrequencyBiweekly:    14,
+	models.RecurringFrequencySemiMonthly: 15,
+	models.RecurringFrequencyMonthly:     30,
+	models.RecurringFrequencyQuarterly:   91,
+	models.RecurringFrequencyAnnually:    365,
+}
+
+var plaidRecurringFrequencies = map[plaid.RecurringTransactionFrequency]string{
+	plaid.RECURRINGTRANSACTIONFREQUENCY_WEEKLY:       models.RecurringFrequencyWeekly,
+	plaid.RECURRINGTRANSACTIONFREQUENCY_BIWEEKLY:     models.RecurringFrequencyBiweekly,
+	plaid.RECURRINGTRANSACTIONFREQUENCY_SEMI_MONTHLY: models.RecurringFrequencySemiMonthly,
+	plaid.RECURRINGTRANSACTIONFREQUENCY_MONTHLY:      models.RecurringFrequencyMonthly,
+	plaid.RECURRINGTRANSACTIONFREQUENCY_ANNUALLY:     models.RecurringFrequencyAnnually,
+}
+
+// Words card processors and banks add to descriptions that say nothing about the merchant
+var merchantNoiseWords = map[string]bool{
+	"pos":       true,
+	"purchase":  true,
+	"debit":     true,
+	"card":      true,
+	"recurring": true,
+	"ach":       true,
+	"www":       true,
+	"com":       true,
+	"inc":       true,
+	"llc":       true,
+}
+
+// recurringCandidate is a stream together with the transactions it was built from
+type recurringCandidate struct {
+	stream       models.RecurringStream
+	transactions []models.Transaction
+}
+
+// normalizeMerchant reduces a merchant name or description to a key that stays the same across charges:
+// lowercase letters only, without noise words, limited to the first few words.
+func normalizeMerchant(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	var kept []string
+	for _, word := range words {
+		if len(word) < 2 || merchantNoiseWords[word] {
+			continue
+		}
+		kept = append(kept, word)
+		if len(kept) == recurringMerchantWords {
+			break
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func recurringMerchantName(t models.Transaction) string {
+	if t.MerchantName != nil && *t.MerchantName != "" {
+		return *t.MerchantName
+	}
+	return t.Name
+}
+
+func recurringDirection(amount float64) string {
+	if amount < 0 {
+		return models.RecurringDirectionInflow
+	}
+	return models.RecurringDirectionOutflow
+}
+
+func withinAmountTolerance(base, amount float64) bool {
+	base, amount = math.Abs(base), math.Abs(amount)
+	return math.Abs(amount-base) <= math.Max(recurringAmountToleranceMin, base*recurringAmountTolerance)
+}
+
+func samePrice(a, b float64) bool {
+	return math.Abs(math.Abs(a)-math.Abs(b)) < 0.01
+}
+
+// detectRecurringStreams finds recurring streams in the user's history. Transactions are grouped by account,
+// normalized merchant and direction, each group is split into amount bands, and the bands whose dates follow
+// a regular cadence become streams.
+func detectRecurringStreams(transactions []models.Transaction, today time.Time) []recurringCandidate {
+	type groupKey struct {
+		accountID   int
+		merchantKey string
+		direction   string
+	}
+	groups := map[groupKey][]models.Transaction{}
+	var order []groupKey
+	for _, t := range transactions {
+		if t.Amount == 0 {
+			continue
+		}
+		key := groupKey{t.AccountID, normalizeMerchant(recurringMerchantName(t)), recurringDirection(t.Amount)}
+		if key.merchantKey == "" {
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], t)
+	}
+
+	var candidates []recurringCandidate
+	for _, key := range order {
+		for _, band := range splitByAmount(groups[key]) {
+			cadence, ok := matchCadence(band)
+			if !ok {
+				continue
+			}
+			stream := summarizeRecurring(band, cadence.frequency, today)
+			stream.Source = models.RecurringSourceDetected
+			stream.MerchantKey = key.merchantKey
+			candidates = append(candidates, recurringCandidate{stream: stream, transactions: band})
+		}
+	}
+	return candidates
+}
+
+// splitByAmount splits a group of charges into bands of similar amounts, each ordered by date
+func splitByAmount(transactions []models.Transaction) [][]models.Transaction {
+	sorted := append([]models.Transaction(nil), transactions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return math.Abs(sorted[i].Amount) < math.Abs(sorted[j].Amount)
+	})
+
+	var bands [][]models.Transaction
+	start := 0
+	for i := 1; i <= len(sorted); i++ {
+		if i < len(sorted) && withinAmountTolerance(sorted[start].Amount, sorted[i].Amount) {
+			continue
+		}
+		band := sorted[start:i]
+		sort.SliceStable(band, func(a, b int) bool {
+			return band[a].Date.Before(band[b].Date)
+		})
+		bands = append(bands, band)
+		start = i
+	}
+	return bands
+}
+
+// matchCadence returns the cadence the median interval between the charges falls in, provided enough of the
+// intervals agree with it.
+func matchCadence(band []models.Transaction) (recurringCadence, bool) {
+	if len(band) < 2 {
+		return recurringCadence{}, false
+	}
+	intervals := make([]int, 0, len(band)-1)
+	for i := 1; i < len(band); i++ {
+		intervals = append(intervals, int(band[i].Date.Sub(band[i-1].Date).Hours()/24))
+	}
+	sorted := append([]int(nil), intervals...)
+	sort.Ints(sorted)
+	median := sorted[len(sorted)/2]
+
+	for _, cadence := range recurringCadences {
+		if median < cadence.minDays || median > cadence.maxDays || len(band) < cadence.minOccurrences {
+			continue
+		}
+		regular := 0
+		for _, interval := range intervals {
+			if interval >= cadence.minDays && interval <= cadence.maxDays {
+				regular++
+			}
+		}
+		if float64(regular) >= recurringRegularity*float64(len(intervals)) {
+			return cadence, true
+		}
+	}
+	return recurringCadence{}, false
+}
+
+// summarizeRecurring builds a stream from its charges, ordered by date. Streams whose next charge is overdue
+// by more than half a cycle are considered cancelled.
+func summarizeRecurring(band []models.Transaction, frequency string, today time.Time) models.RecurringStream {
+	first, last := band[0], band[len(band)-1]
+	total := 0.0
+	for _, t := range band {
+		total += math.Abs(t.Amount)
+	}
+
+	next := nextRecurringDate(last.Date, frequency, 1)
+	stream := models.RecurringStream{
+		AccountID:        last.AccountID,
+		MerchantName:     recurringMerchantName(last),
+		Category:         last.PrimaryCategory,
+		Direction:        recurringDirection(last.Amount),
+		Frequency:        frequency,
+		AverageAmount:    total / float64(len(band)),
+		LastAmount:       math.Abs(last.Amount),
+		FirstDate:        first.Date,
+		LastDate:         last.Date,
+		NextExpectedDate: &next,
+		TransactionCount: len(band),
+		Status:           models.RecurringStatusActive,
+	}
+	stream.PreviousAmount, stream.PriceChangedOn = detectPriceChange(band)
+	if today.After(next.AddDate(0, 0, recurringFrequencyDays[frequency]/2)) {
+		stream.Status = models.RecurringStatusCancelled
+	}
+	return stream
+}
+
+// detectPriceChange returns the amount before the most recent price change and the date of the first charge
+// at the new price. Only fixed amounts count: the two charges before the change must match, so bills that
+// vary every cycle are not reported.
+func detectPriceChange(band []models.Transaction) (*float64, *time.Time) {
+	for i := len(band) - 1; i >= 2; i-- {
+		if samePrice(band[i].Amount, band[i-1].Amount) {
+			continue
+		}
+		if !samePrice(band[i-1].Amount, band[i-2].Amount) {
+			return nil, nil
+		}
+		previous := math.Abs(band[i-1].Amount)
+		changedOn := band[i].Date
+		return &previous, &changedOn
+	}
+	return nil, nil
+}
+
+// nextRecurringDate returns the date n cycles after date. Months are added without overflowing, so a charge on
+// the 31st is expected on the last day of shorter months.
+func nextRecurringDate(date time.Time, frequency string, n int) time.Time {
+	switch frequency {
+	case models.RecurringFrequencyMonthly:
+		return addMonths(date, n)
+	case models.RecurringFrequencyQuarterly:
+		return addMonths(date, 3*n)
+	case models.RecurringFrequencyAnnually:
+		return addMonths(date, 12*n)
+	}
+	return date.AddDate(0, 0, recurringFrequencyDays[frequency]*n)
+}
+
+func addMonths(date time.Time, months int) time.Time {
+	month := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location()).AddDate(0, months, 0)
+	day := date.Day()
+	if lastDay := month.AddDate(0, 1, -1).Day(); day > lastDay {
+		day = lastDay
+	}
+	return time.Date(month.Year(), month.Month(), day, 0, 0, 0, 0, date.Location())
+}
+
+// plaidRecurringStreams turns the streams Plaid reports for an item into candidates. Each is placed on an
+// account, and checked for price changes, through the stored transactions Plaid grouped into it; streams
+// with none stored yet are skipped.
+func plaidRecurringStreams(resp plaid.TransactionsRecurringGetResponse, byTransactionID map[string]models.Transaction, today time.Time) []recurringCandidate {
+	var candidates []recurringCandidate
+	add := func(plaidStreams []plaid.TransactionStream, direction string) {
+		for _, ps := range plaidStreams {
+			var band []models.Transaction
+			for _, id := range ps.GetTransactionIds() {
+				if t, ok := byTransactionID[id]; ok {
+					band = append(band, t)
+				}
+			}
+			if len(band) == 0 {
+				continue
+			}
+			sort.SliceStable(band, func(i, j int) bool {
+				return band[i].Date.Before(band[j].Date)
+			})
+
+			frequency, ok := plaidRecurringFrequencies[ps.GetFrequency()]
+			if !ok {
+				cadence, matched := matchCadence(band)
+				if !matched {
+					continue
+				}
+				frequency = cadence.frequency
+			}
+
+			streamID := ps.GetStreamId()
+			stream := summarizeRecurring(band, frequency, today)
+			stream.Source = models.RecurringSourcePlaid
+			stream.PlaidStreamID = &streamID
+			// Keyed like detected streams so a stream keeps its row when it moves between the two sources
+			stream.MerchantKey = normalizeMerchant(recurringMerchantName(band[len(band)-1]))
+			stream.Direction = direction
+			if name := ps.MerchantName.Get(); name != nil && *name != "" {
+				stream.MerchantName = *name
+			} else if ps.GetDescription() != "" {
+				stream.MerchantName = ps.GetDescription()
+			}
+			if amount := ps.AverageAmount.Amount; amount != nil {
+				stream.AverageAmount = math.Abs(*amount)
+			}
+			if predicted := parsePlaidDate(ps.PredictedNextDate.Get()); predicted != nil {
+				stream.NextExpectedDate = predicted
+			}
+			if ps.GetIsActive() && ps.GetStatus() != plaid.TRANSACTIONSTREAMSTATUS_TOMBSTONED {
+				stream.Status = models.RecurringStatusActive
+			} else {
+				stream.Status = models.RecurringStatusCancelled
+			}
+			candidates = append(candidates, recurringCandidate{stream: stream, transactions: band})
+		}
+	}
+	add(resp.GetOutflowStreams(), models.RecurringDirectionOutflow)
+	add(resp.GetInflowStreams(), models.RecurringDirectionInflow)
+	return candidates
+}
+
+// heldPlaidStreams keeps the stored Plaid streams on the given accounts, whose item could not be asked for
+// fresh ones. Each is paired with the stored transactions of the same account, merchant and direction so
+// detection does not report those charges as a second stream.
+func heldPlaidStreams(existing []models.RecurringStream, accountIDs map[int]bool, transactions []models.Transaction) []recurringCandidate {
+	var candidates []recurringCandidate
+	for _, e := range existing {
+		if e.Source != models.RecurringSourcePlaid || !accountIDs[e.AccountID] {
+			continue
+		}
+		var band []models.Transaction
+		for _, t := range transactions {
+			if t.AccountID == e.AccountID && recurringDirection(t.Amount) == e.Direction &&
+				normalizeMerchant(recurringMerchantName(t)) == e.MerchantKey {
+				band = append(band, t)
+			}
+		}
+		candidates = append(candidates, recurringCandidate{stream: e, transactions: band})
+	}
+	return candidates
+}
+
+// mergeRecurringStreams combines Plaid's streams with the detected ones, preferring Plaid's where both found
+// the same charges. Streams that continue a stored stream take over its ID, so the stored row is updated
+// rather than replaced.
+func mergeRecurringStreams(existing []models.RecurringStream, plaidCandidates, detected []recurringCandidate) []models.RecurringStream {
+	covered := map[string]bool{}
+	for _, c := range plaidCandidates {
+		for _, t := range c.transactions {
+			covered[t.TransactionID] = true
+		}
+	}
+
+	candidates := append([]recurringCandidate(nil), plaidCandidates...)
+	for _, c := range detected {
+		overlaps := false
+		for _, t := range c.transactions {
+			if covered[t.TransactionID] {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			candidates = append(candidates, c)
+		}
+	}
+
+	used := map[int]bool{}
+	match := func(stream models.RecurringStream) int {
+		if stream.PlaidStreamID != nil {
+			for _, e := range existing {
+				if !used[e.ID] && e.PlaidStreamID != nil && *e.PlaidStreamID == *stream.PlaidStreamID {
+					return e.ID
+				}
+			}
+		}
+		for _, e := range existing {
+			if used[e.ID] || e.AccountID != stream.AccountID || e.MerchantKey != stream.MerchantKey || e.Direction != stream.Direction {
+				continue
+			}
+			if withinAmountTolerance(e.LastAmount, stream.LastAmount) ||
+				(stream.PreviousAmount != nil && samePrice(e.LastAmount, *stream.PreviousAmount)) {
+				return e.ID
+			}
+		}
+		return 0
+	}
+
+	streams := make([]models.RecurringStream, 0, len(candidates))
+	for _, c := range candidates {
+		stream := c.stream
+		stream.ID = match(stream)
+		if stream.ID != 0 {
+			used[stream.ID] = true
+		}
+		streams = append(streams, stream)
+	}
+	return streams
+}
+
+// expectedCharges lists the occurrences of the active streams up to the given date. A charge that is late but
+// still within its grace period is listed as overdue.
+func expectedCharges(streams []models.RecurringStream, today, until time.Time) []models.ExpectedCharge {
+	charges := []models.ExpectedCharge{}
+	for _, s := range streams {
+		if s.Status != models.RecurringStatusActive || s.NextExpectedDate == nil {
+			continue
+		}
+		for n := 0; ; n++ {
+			date := nextRecurringDate(*s.NextExpectedDate, s.Frequency, n)
+			if date.After(until) {
+				break
+			}
+			overdue := date.Before(today)
+			if overdue && n > 0 {
+				continue
+			}
+			charges = append(charges, models.ExpectedCharge{
+				StreamID:     s.ID,
+				AccountID:    s.AccountID,
+				AccountName:  s.AccountName,
+				MerchantName: s.MerchantName,
+				Category:     s.Category,
+				Direction:    s.Direction,
+				Frequency:    s.Frequency,
+				Date:         date,
+				Amount:       s.LastAmount,
+				Overdue:      overdue,
+			})
+		}
+	}
+	sort.SliceStable(charges, func(i, j int) bool {
+		return charges[i].Date.Before(charges[j].Date)
+	})
+	return charges
+}
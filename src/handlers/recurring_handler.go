@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/jobs"
+	"budgee-server/src/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+const (
+	defaultRecurringWindowDays = 30
+	maxRecurringWindowDays     = 365
+)
+
+// recurringUnavailableCodes are the Plaid errors meaning an item has no recurring streams from Plaid, either
+// because the product is not available for it or because Plaid has not finished preparing them
+var recurringUnavailableCodes = map[string]bool{
+	"PRODUCTS_NOT_SUPPORTED":      true,
+	"ADDITIONAL_CONSENT_REQUIRED": true,
+	"INVALID_PRODUCT":             true,
+	"PRODUCT_NOT_ENABLED":         true,
+	"PRODUCT_NOT_READY":           true,
+}
+
+// EnqueueRecurringDetection queues a refresh of the user's recurring streams, merged into one that is still
+// waiting.
+func EnqueueRecurringDetection(ctx context.Context, pool *pgxpool.Pool, userID int64) (int64, error) {
+	return db.EnqueueJob(ctx, pool, models.JobKindDetectRecurring, strconv.FormatInt(userID, 10), models.DetectRecurringPayload{UserID: userID}, syncItemJobMaxAttempts)
+}
+
+// DetectRecurringJob handles JobKindDetectRecurring jobs
+func DetectRecurringJob(plaidClient *plaid.APIClient, pool *pgxpool.Pool, usePlaid bool) jobs.Handler {
+	return func(ctx context.Context, job *models.Job) error {
+		var payload models.DetectRecurringPayload
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid %s job payload: %w", job.Kind, err)
+		}
+
+		streams, err := DetectRecurringStreamsForUser(ctx, pool, plaidClient, payload.UserID, usePlaid)
+		if err != nil {
+			return err
+		}
+		log.Printf("INFO: Found %d recurring streams for user %d", len(streams), payload.UserID)
+		return nil
+	}
+}
+
+// DetectRecurringStreamsForUser rebuilds the user's recurring streams from their transaction history. When
+// usePlaid is set, the streams Plaid reports for each item are used where available and detection fills in
+// the rest; items without Plaid's recurring data rely on detection alone, and items that are broken keep the
+// streams Plaid last reported for them.
+func DetectRecurringStreamsForUser(ctx context.Context, pool *pgxpool.Pool, plaidClient *plaid.APIClient, userID int64, usePlaid bool) ([]models.RecurringStream, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	transactions, err := db.GetRecurringCandidateTransactions(ctx, pool, userID, today.AddDate(0, 0, -recurringHistoryDays))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := db.GetRecurringStreams(ctx, pool, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var plaidCandidates []recurringCandidate
+	if usePlaid {
+		byTransactionID := make(map[string]models.Transaction, len(transactions))
+		for _, t := range transactions {
+			byTransactionID[t.TransactionID] = t
+		}
+
+		items, err := db.GetPlaidItemsSQL(ctx, pool, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get items for user %d: %w", userID, err)
+		}
+		heldAccounts := map[int]bool{}
+		for _, item := range items {
+			held, streams, err := plaidRecurringStreamsForItem(ctx, plaidClient, item, byTransactionID, today)
+			if err != nil {
+				return nil, err
+			}
+			if !held {
+				plaidCandidates = append(plaidCandidates, streams...)
+				continue
+			}
+			accounts, err := db.GetAccountsForItemSQL(ctx, pool, item.ItemID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get accounts for item %s: %w", item.ItemID, err)
+			}
+			for _, a := range accounts {
+				if id, err := strconv.Atoi(a.ID); err == nil {
+					heldAccounts[id] = true
+				}
+			}
+		}
+		plaidCandidates = append(plaidCandidates, heldPlaidStreams(existing, heldAccounts, transactions)...)
+	}
+
+	streams := mergeRecurringStreams(existing, plaidCandidates, detectRecurringStreams(transactions, today))
+	if err := db.SaveRecurringStreams(ctx, pool, userID, streams); err != nil {
+		return nil, fmt.Errorf("failed to save recurring streams for user %d: %w", userID, err)
+	}
+	return db.GetRecurringStreams(ctx, pool, userID)
+}
+
+// plaidRecurringStreamsForItem asks Plaid for the item's recurring streams. Items Plaid has no streams for get
+// none, and detection covers them. Items that are broken, or that Plaid reports an item error for, are held:
+// their stored Plaid streams are kept until the item is repaired rather than one bank failing the whole
+// user. Only transport and server errors are returned, so the job retries.
+func plaidRecurringStreamsForItem(ctx context.Context, plaidClient *plaid.APIClient, item models.PlaidItem, byTransactionID map[string]models.Transaction, today time.Time) (held bool, candidates []recurringCandidate, err error) {
+	if item.Status == models.ItemStatusError || item.Status == models.ItemStatusRevoked {
+		log.Printf("INFO: Item %s is %s, keeping its recurring streams from Plaid", item.ItemID, item.Status)
+		return true, nil, nil
+	}
+
+	request := plaid.NewTransactionsRecurringGetRequest(item.AccessToken)
+	resp, httpResp, err := plaidClient.PlaidApi.TransactionsRecurringGet(ctx).TransactionsRecurringGetRequest(*request).Execute()
+	if err == nil {
+		return false, plaidRecurringStreams(resp, byTransactionID, today), nil
+	}
+
+	plaidErr, convErr := plaid.ToPlaidError(err)
+	switch {
+	case convErr == nil && recurringUnavailableCodes[plaidErr.ErrorCode]:
+		log.Printf("INFO: No recurring streams from Plaid for item %s (%s), using detection", item.ItemID, plaidErr.ErrorCode)
+		return false, nil, nil
+	case convErr != nil || httpResp == nil || httpResp.StatusCode >= http.StatusInternalServerError:
+		return false, nil, fmt.Errorf("failed to get recurring streams for item %s: %w", item.ItemID, err)
+	default:
+		log.Printf("INFO: Plaid returned %s for item %s, keeping its recurring streams from Plaid", plaidErr.ErrorCode, item.ItemID)
+		return true, nil, nil
+	}
+}
+
+// parseRecurringWindow reads the days query parameter, the number of days a recurring endpoint looks ahead or back
+func parseRecurringWindow(w http.ResponseWriter, r *http.Request) (int, bool) {
+	days := defaultRecurringWindowDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxRecurringWindowDays {
+			http.Error(w, "days must be between 1 and "+strconv.Itoa(maxRecurringWindowDays), http.StatusBadRequest)
+			return 0, false
+		}
+		days = n
+	}
+	return days, true
+}
+
+func GetRecurringStreams(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		streams, err := db.GetRecurringStreams(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get recurring streams for user %d: %v", userID, err)
+			http.Error(w, "failed to get recurring streams", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(streams)
+	}
+}
+
+// GetUpcomingRecurringCharges lists the charges and deposits the user's active streams are expected to make
+// in the next days (30 by default), soonest first, with the expected totals in each direction.
+func GetUpcomingRecurringCharges(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		days, ok := parseRecurringWindow(w, r)
+		if !ok {
+			return
+		}
+
+		streams, err := db.GetRecurringStreams(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get recurring streams for user %d: %v", userID, err)
+			http.Error(w, "failed to get upcoming charges", http.StatusInternalServerError)
+			return
+		}
+
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		until := today.AddDate(0, 0, days)
+		charges := expectedCharges(streams, today, until)
+
+		outflow, inflow := 0.0, 0.0
+		for _, c := range charges {
+			if c.Direction == models.RecurringDirectionInflow {
+				inflow += c.Amount
+			} else {
+				outflow += c.Amount
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":             today.Format("2006-01-02"),
+			"to":               until.Format("2006-01-02"),
+			"expected_outflow": outflow,
+			"expected_inflow":  inflow,
+			"charges":          charges,
+		})
+	}
+}
+
+// GetRecurringChanges reports what changed in the user's recurring streams over the past days (30 by
+// default): streams first detected in that time, streams that were cancelled because an expected charge
+// never came, and fixed amounts whose price changed.
+func GetRecurringChanges(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		days, ok := parseRecurringWindow(w, r)
+		if !ok {
+			return
+		}
+
+		streams, err := db.GetRecurringStreams(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get recurring streams for user %d: %v", userID, err)
+			http.Error(w, "failed to get recurring changes", http.StatusInternalServerError)
+			return
+		}
+
+		since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -days)
+		added := []models.RecurringStream{}
+		cancelled := []models.RecurringStream{}
+		priceChanged := []models.RecurringStream{}
+		for _, s := range streams {
+			if !s.CreatedAt.Before(since) {
+				added = append(added, s)
+			}
+			// Detection gives up on a stream half a cycle after the charge it expected
+			if s.Status == models.RecurringStatusCancelled && s.NextExpectedDate != nil &&
+				!s.NextExpectedDate.AddDate(0, 0, recurringFrequencyDays[s.Frequency]/2).Before(since) {
+				cancelled = append(cancelled, s)
+			}
+			if s.PriceChangedOn != nil && !s.PriceChangedOn.Before(since) {
+				priceChanged = append(priceChanged, s)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"new":           added,
+			"cancelled":     cancelled,
+			"price_changed": priceChanged,
+		})
+	}
+}
+
+// DetectRecurringStreams rebuilds the user's recurring streams right away instead of waiting for the next sync
+func DetectRecurringStreams(plaidClient *plaid.APIClient, pool *pgxpool.Pool, usePlaid bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("user_id").(int64)
+
+		streams, err := DetectRecurringStreamsForUser(r.Context(), pool, plaidClient, userID, usePlaid)
+		if err != nil {
+			log.Printf("ERROR: Failed to detect recurring streams for user %d: %v", userID, err)
+			http.Error(w, "failed to detect recurring streams", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(streams)
+	}
+}
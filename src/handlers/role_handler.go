@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/util"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func GetRoles(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		roles, err := db.GetRoles(r.Context(), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get roles: %v", err)
+			http.Error(w, "failed to get roles", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roles)
+	}
+}
+
+func GetUserRoles(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		idStr := chi.URLParam(r, "user_id")
+		userID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Printf("ERROR: Invalid user id param for get user roles: %s", idStr)
+			http.Error(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		roles, err := db.GetRolesForUser(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get roles for user %d: %v", userID, err)
+			http.Error(w, "failed to get roles", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(roles)
+	}
+}
+
+func AssignUserRole(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID := r.Context().Value("user_id").(int64)
+		userID, roleName, ok := parseUserRoleParams(w, r, adminID)
+		if !ok {
+			return
+		}
+
+		audit := util.Audit(r)
+		audit.Action = "user.role.assign"
+		audit.TargetType = "user"
+		audit.TargetID = strconv.FormatInt(userID, 10)
+		audit.After = map[string]string{"role": roleName}
+
+		err := db.AssignRole(r.Context(), pool, userID, roleName, adminID)
+		if errors.Is(err, db.ErrRoleNotFound) {
+			http.Error(w, "role not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to assign role %s to user %d: %v", roleName, userID, err)
+			http.Error(w, "failed to assign role", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Role assigned - Role: %s, User: %d, Granted by: %d", roleName, userID, adminID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RemoveUserRole(pool *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminID := r.Context().Value("user_id").(int64)
+		userID, roleName, ok := parseUserRoleParams(w, r, adminID)
+		if !ok {
+			return
+		}
+
+		audit := util.Audit(r)
+		audit.Action = "user.role.remove"
+		audit.TargetType = "user"
+		audit.TargetID = strconv.FormatInt(userID, 10)
+		audit.Before = map[string]string{"role": roleName}
+
+		err := db.RemoveRole(r.Context(), pool, userID, roleName)
+		if errors.Is(err, db.ErrRoleNotFound) {
+			http.Error(w, "user does not have this role", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: Failed to remove role %s from user %d: %v", roleName, userID, err)
+			http.Error(w, "failed to remove role", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("INFO: Role removed - Role: %s, User: %d, Removed by: %d", roleName, userID, adminID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// parseUserRoleParams reads the target user and role from the URL. Admins may not change their own
+// roles, which keeps the last admin from locking everyone out by accident.
+func parseUserRoleParams(w http.ResponseWriter, r *http.Request, adminID int64) (int64, string, bool) {
+	idStr := chi.URLParam(r, "user_id")
+	userID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Printf("ERROR: Invalid user id param for role change: %s", idStr)
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return 0, "", false
+	}
+	if userID == adminID {
+		http.Error(w, "you cannot change your own roles", http.StatusForbidden)
+		return 0, "", false
+	}
+	return userID, chi.URLParam(r, "role"), true
+}
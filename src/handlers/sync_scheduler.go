@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"budgee-server/src/config"
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// RunSyncScheduler syncs every item that has not been synced within the configured interval, as a safety net
+// for missed webhooks. It blocks until ctx is done. Several instances can run it at once: an item another
+// instance has just synced is skipped, and of two syncs that overlap only one applies its changes.
+func RunSyncScheduler(ctx context.Context, plaidClient *plaid.APIClient, pool *pgxpool.Pool, cfg config.SyncScheduleConfig) {
+	if cfg.Interval <= 0 {
+		log.Printf("INFO: Scheduled item sync is disabled")
+		return
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		runScheduledSyncRound(ctx, plaidClient, pool, cfg)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runScheduledSyncRound syncs the stale items, stalest first, starting at most RatePerMinute syncs a minute
+// with no more than Concurrency running at once.
+func runScheduledSyncRound(ctx context.Context, plaidClient *plaid.APIClient, pool *pgxpool.Pool, cfg config.SyncScheduleConfig) {
+	itemIDs, err := db.GetItemIDsDueForSync(ctx, pool, cfg.Interval)
+	if err != nil {
+		log.Printf("ERROR: Scheduled sync: failed to get items due for sync: %v", err)
+		return
+	}
+	if len(itemIDs) == 0 {
+		return
+	}
+	log.Printf("INFO: Scheduled sync: %d item(s) due", len(itemIDs))
+
+	limiter := time.NewTicker(time.Minute / time.Duration(max(cfg.RatePerMinute, 1)))
+	defer limiter.Stop()
+	slots := make(chan struct{}, max(cfg.Concurrency, 1))
+
+	var wg sync.WaitGroup
+	for i, itemID := range itemIDs {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+			case <-limiter.C:
+			}
+		}
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(itemID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			scheduledSyncItem(ctx, plaidClient, pool, itemID, cfg.Interval)
+		}(itemID)
+	}
+	wg.Wait()
+}
+
+func scheduledSyncItem(ctx context.Context, plaidClient *plaid.APIClient, pool *pgxpool.Pool, itemID string, staleAfter time.Duration) {
+	item, err := db.GetPlaidItemByItemID(ctx, pool, itemID)
+	if err != nil {
+		log.Printf("ERROR: Scheduled sync: failed to fetch item %s: %v", itemID, err)
+		return
+	}
+	dbItemID, err := strconv.ParseInt(item.ID, 10, 64)
+	if err != nil {
+		log.Printf("ERROR: Scheduled sync: invalid id for item %s: %v", itemID, err)
+		return
+	}
+
+	// Another instance may have synced the item since the list of due items was read
+	due, err := db.IsItemSyncDue(ctx, pool, dbItemID, staleAfter)
+	if err != nil || !due {
+		return
+	}
+
+	if _, err := SyncTransactionsForItem(ctx, pool, plaidClient, item); err != nil {
+		if errors.Is(err, db.ErrItemSyncInProgress) || errors.Is(err, db.ErrSyncCursorMoved) {
+			log.Printf("INFO: Scheduled sync: item %s was synced by someone else, skipping", itemID)
+			return
+		}
+		if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && userActionErrorCodes[plaidErr.ErrorCode] {
+			log.Printf("INFO: Scheduled sync: item %s needs user action (%s)", itemID, plaidErr.ErrorCode)
+			if err := db.SetPlaidItemError(ctx, pool, itemID, models.ItemStatusError, plaidErr.ErrorCode, plaidErr.ErrorMessage); err != nil {
+				log.Printf("ERROR: Scheduled sync: failed to record error status for item %s: %v", itemID, err)
+			}
+			return
+		}
+		log.Printf("ERROR: Scheduled sync: failed to sync transactions for item %s: %v", itemID, err)
+		return
+	}
+
+	if err := UpdateAccountBalances(ctx, plaidClient, pool, itemID); err != nil {
+		log.Printf("ERROR: Scheduled sync: failed to update account balances for item %s: %v", itemID, err)
+		return
+	}
+	log.Printf("INFO: Scheduled sync: synced item %s", itemID)
+}
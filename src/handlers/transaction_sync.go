@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
+)
+
+// How many times pagination is started over when Plaid reports the item changed mid-sync
+const maxSyncPaginationRestarts = 3
+
+// TransactionSyncResult summarizes one sync of an item.
+type TransactionSyncResult struct {
+	ItemID       string `json:"item_id"`
+	Added        int    `json:"added"`
+	Modified     int    `json:"modified"`
+	Removed      int    `json:"removed"`
+	RulesApplied int    `json:"rules_applied"`
+}
+
+// SyncTransactionsForItem pulls every change since the item's stored cursor and applies it, together with the
+// new cursor, in one database transaction. The user's transaction rules are applied afterwards, and when anything
+// changed a refresh of the user's recurring streams is queued.
+func SyncTransactionsForItem(ctx context.Context, pool *pgxpool.Pool, plaidClient *plaid.APIClient, item *models.PlaidItem) (*TransactionSyncResult, error) {
+	itemIDInt, err := strconv.ParseInt(item.ID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := db.GetSyncCursor(ctx, pool, itemIDInt)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes db.TransactionSyncChanges
+	for restarts := 0; ; restarts++ {
+		changes, err = fetchTransactionChanges(ctx, plaidClient, item.AccessToken, cursor)
+		if err == nil {
+			break
+		}
+		// Plaid asks for the whole run to be repeated from the original cursor when data changes mid-pagination
+		if plaidErr, convErr := plaid.ToPlaidError(err); convErr == nil && plaidErr.ErrorCode == "TRANSACTIONS_SYNC_MUTATION_DURING_PAGINATION" && restarts < maxSyncPaginationRestarts {
+			log.Printf("INFO: Item %d changed during sync pagination, restarting", itemIDInt)
+			continue
+		}
+		return nil, err
+	}
+
+	if err := db.ApplyTransactionSync(ctx, pool, itemIDInt, item.UserID, changes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: Successfully synced transactions for user %d, item %d - Added: %d, Modified: %d, Removed: %d",
+		item.UserID, itemIDInt, len(changes.Added), len(changes.Modified), len(changes.Removed))
+
+	result := &TransactionSyncResult{
+		ItemID:   item.ItemID,
+		Added:    len(changes.Added),
+		Modified: len(changes.Modified),
+		Removed:  len(changes.Removed),
+	}
+
+	// Apply transaction rules after syncing
+	result.RulesApplied, err = db.ApplyTransactionRulesToUser(ctx, pool, item.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Detection failing to queue does not fail the sync, the next sync with changes queues it again
+	if result.Added+result.Modified+result.Removed > 0 {
+		if _, err := EnqueueRecurringDetection(ctx, pool, item.UserID); err != nil {
+			log.Printf("ERROR: Failed to queue recurring stream detection for user %d: %v", item.UserID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// fetchTransactionChanges pages through /transactions/sync starting at cursor and collects every change.
+func fetchTransactionChanges(ctx context.Context, plaidClient *plaid.APIClient, accessToken, cursor string) (db.TransactionSyncChanges, error) {
+	changes := db.TransactionSyncChanges{PrevCursor: cursor, NextCursor: cursor}
+
+	options := plaid.NewTransactionsSyncRequestOptions()
+	options.SetIncludePersonalFinanceCategory(true)
+	options.SetPersonalFinanceCategoryVersion(plaid.PERSONALFINANCECATEGORYVERSION_V2)
+
+	hasMore := true
+	for hasMore {
+		request := plaid.NewTransactionsSyncRequest(accessToken)
+		request.SetOptions(*options)
+		if changes.NextCursor != "" {
+			request.SetCursor(changes.NextCursor)
+		}
+		transactionsResp, _, err := plaidClient.PlaidApi.TransactionsSync(ctx).TransactionsSyncRequest(*request).Execute()
+		if err != nil {
+			return db.TransactionSyncChanges{}, err
+		}
+		changes.Added = append(changes.Added, transactionsResp.GetAdded()...)
+		changes.Modified = append(changes.Modified, transactionsResp.GetModified()...)
+		changes.Removed = append(changes.Removed, transactionsResp.GetRemoved()...)
+		hasMore = transactionsResp.GetHasMore()
+		changes.NextCursor = transactionsResp.GetNextCursor()
+	}
+
+	return changes, nil
+}
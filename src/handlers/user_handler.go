@@ -2,14 +2,17 @@ package handlers
 
 import (
 	db "budgee-server/src/db/sql"
+	"budgee-server/src/mailer"
 	"budgee-server/src/util"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/plaid/plaid-go/v41/plaid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -43,7 +46,9 @@ func GetUser(pool *pgxpool.Pool) http.HandlerFunc {
 	}
 }
 
-func UpdateUser(pool *pgxpool.Pool) http.HandlerFunc {
+// UpdateUser updates the caller's profile. A new email is not applied directly: it is held as pending until
+// the link sent to the new address is followed.
+func UpdateUser(pool *pgxpool.Pool, mail mailer.Mailer, appBaseURL string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value("user_id").(int64)
 
@@ -60,22 +65,34 @@ func UpdateUser(pool *pgxpool.Pool) http.HandlerFunc {
 		}
 
 		// Validate email if provided
-		if req.Email != nil && *req.Email != "" && !util.ValidateEmail(*req.Email) {
+		if req.Email != nil && !util.ValidateEmail(strings.TrimSpace(*req.Email)) {
 			log.Printf("ERROR: Email validation failed during user update - Email: %s, User: %d", *req.Email, userID)
 			http.Error(w, "invalid email format", http.StatusBadRequest)
 			return
 		}
 
+		user, err := db.GetUserByID(int(userID), pool)
+		if err != nil {
+			log.Printf("ERROR: Failed to get user %d for profile update: %v", userID, err)
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		newEmail := ""
+		if req.Email != nil && strings.TrimSpace(*req.Email) != user.Email {
+			newEmail = strings.TrimSpace(*req.Email)
+			if existing, err := db.GetUserByEmail(newEmail, pool); err == nil && existing.ID != userID {
+				log.Printf("ERROR: Email change for user %d conflicts with an existing account", userID)
+				http.Error(w, "email is already in use", http.StatusConflict)
+				return
+			}
+		}
+
 		// Build dynamic update fields and args
 		fields := []string{}
 		args := []interface{}{}
 		argIdx := 1
 
-		if req.Email != nil {
-			fields = append(fields, "email = $"+strconv.Itoa(argIdx))
-			args = append(args, *req.Email)
-			argIdx++
-		}
 		if req.FirstName != nil {
 			fields = append(fields, "first_name = $"+strconv.Itoa(argIdx))
 			args = append(args, *req.FirstName)
@@ -92,23 +109,45 @@ func UpdateUser(pool *pgxpool.Pool) http.HandlerFunc {
 			argIdx++
 		}
 
-		if len(fields) == 0 {
+		if len(fields) == 0 && req.Email == nil {
 			http.Error(w, "no fields to update", http.StatusBadRequest)
 			return
 		}
 
-		// Always update updated_at
-		fields = append(fields, "updated_at = NOW()")
-		query := "UPDATE users SET " +
-			(func() string { return stringJoin(fields, ", ") })() +
-			" WHERE id = $" + strconv.Itoa(argIdx)
-		args = append(args, userID)
+		if len(fields) > 0 {
+			// Always update updated_at
+			fields = append(fields, "updated_at = NOW()")
+			query := "UPDATE users SET " +
+				(func() string { return stringJoin(fields, ", ") })() +
+				" WHERE id = $" + strconv.Itoa(argIdx)
+			args = append(args, userID)
 
-		_, err := pool.Exec(r.Context(), query, args...)
-		if err != nil {
-			log.Printf("ERROR: Failed to update user profile - user_id: %d: %v", userID, err)
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
+			_, err := pool.Exec(r.Context(), query, args...)
+			if err != nil {
+				log.Printf("ERROR: Failed to update user profile - user_id: %d: %v", userID, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		message := "profile updated successfully"
+		if newEmail != "" {
+			if err := db.SetPendingEmail(r.Context(), pool, userID, newEmail); err != nil {
+				log.Printf("ERROR: Failed to set pending email for user %d: %v", userID, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if err := sendEmailVerification(mail, appBaseURL, userID, user.FirstName, newEmail, true); err != nil {
+				log.Printf("ERROR: Failed to issue email verification for user %d: %v", userID, err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			message = "profile updated, confirm your new email from the link we sent to it"
+		} else if req.Email != nil && user.PendingEmail != nil {
+			// Setting the current email again abandons a pending change
+			if err := db.CancelPendingEmail(r.Context(), pool, userID); err != nil {
+				log.Printf("ERROR: Failed to cancel pending email for user %d: %v", userID, err)
+			}
 		}
 
 		log.Printf("INFO: User profile updated - User: %d", userID)
@@ -116,7 +155,7 @@ func UpdateUser(pool *pgxpool.Pool) http.HandlerFunc {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]string{
-			"message": "profile updated successfully",
+			"message": message,
 		})
 	}
 }
@@ -206,6 +245,13 @@ func AdminUpdateUser(pool *pgxpool.Pool) http.HandlerFunc {
 			" WHERE id = $" + strconv.Itoa(argIdx)
 		args = append(args, userID)
 
+		audit := util.Audit(r)
+		audit.Action = "user.update"
+		audit.TargetType = "user"
+		if before, err := db.GetUserByID(int(userID), pool); err == nil {
+			audit.Before = auditUserSnapshot(before)
+		}
+
 		_, err = pool.Exec(r.Context(), query, args...)
 		if err != nil {
 			log.Printf("ERROR: Failed to admin update user profile - user_id: %d: %v", userID, err)
@@ -213,6 +259,13 @@ func AdminUpdateUser(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		if after, err := db.GetUserByID(int(userID), pool); err == nil {
+			after := auditUserSnapshot(after)
+			// The hash itself never goes into the log, only the fact that the password was reset
+			after["password_changed"] = req.Password != nil
+			audit.After = after
+		}
+
 		log.Printf("INFO: User profile updated by Admin - User: %d", userID)
 
 		w.Header().Set("Content-Type", "application/json")
@@ -280,46 +333,8 @@ func ChangePassword(pool *pgxpool.Pool) http.HandlerFunc {
 	}
 }
 
-func DeleteUser(pool *pgxpool.Pool) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		userID := r.Context().Value("user_id").(int64)
-
-		log.Printf("INFO: DeleteUser called for user_id: %d", userID)
-
-		// Security: Only allow user to delete themselves
-		var req struct {
-			UserID int64 `json:"user_id"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			log.Printf("ERROR: Failed to decode delete user request body for user_id: %d: %v", userID, err)
-			http.Error(w, "invalid request", http.StatusBadRequest)
-			return
-		}
-		if req.UserID != userID {
-			log.Printf("ERROR: Forbidden delete attempt - Authenticated user: %d, Requested user: %d", userID, req.UserID)
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
-		}
-
-		log.Printf("INFO: Deleting user %d and all associated data", userID)
-		err := db.DeleteUser(int(userID), pool)
-		if err != nil {
-			log.Printf("ERROR: Failed to delete user %d: %v", userID, err)
-			http.Error(w, "failed to delete user", http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("INFO: User %d deleted successfully. Instructing client to remove JWT and redirect.", userID)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{
-			"message":  "user deleted",
-			"redirect": "/register",
-		})
-	}
-}
-
-func AdminDeleteUser(pool *pgxpool.Pool) http.HandlerFunc {
+// AdminDeleteUser deletes the user immediately, without a grace period, after removing their items from Plaid.
+func AdminDeleteUser(plaidClient *plaid.APIClient, pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		requestedUserID := chi.URLParam(r, "user_id")
 		userID, err := strconv.ParseInt(requestedUserID, 10, 64)
@@ -331,8 +346,15 @@ func AdminDeleteUser(pool *pgxpool.Pool) http.HandlerFunc {
 
 		log.Printf("INFO: Admin DeleteUser called for user_id: %d", userID)
 
+		audit := util.Audit(r)
+		audit.Action = "user.delete"
+		audit.TargetType = "user"
+		if before, err := db.GetUserByID(int(userID), pool); err == nil {
+			audit.Before = auditUserSnapshot(before)
+		}
+
 		log.Printf("INFO: Deleting user %d and all associated data", userID)
-		err = db.DeleteUser(int(userID), pool)
+		err = purgeUser(r.Context(), plaidClient, pool, userID)
 		if err != nil {
 			log.Printf("ERROR: Failed to admin delete user %d: %v", userID, err)
 			http.Error(w, "failed to admin delete user", http.StatusInternalServerError)
@@ -372,6 +394,13 @@ func LockUser(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		audit := util.Audit(r)
+		audit.Action = "user.lock"
+		audit.TargetType = "user"
+		if before, err := db.GetUserByID(int(userID), pool); err == nil {
+			audit.Before = map[string]interface{}{"locked": before.Locked, "locked_until": before.LockedUntil}
+		}
+
 		err = db.LockUser(r.Context(), pool, userID)
 		if err != nil {
 			log.Printf("ERROR: Failed to lock user %d: %v", userID, err)
@@ -379,6 +408,13 @@ func LockUser(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		_, err = db.RevokeAllSessionsForUser(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to revoke sessions for locked user %d: %v", userID, err)
+		}
+
+		audit.After = map[string]interface{}{"locked": true, "locked_until": nil}
+
 		log.Printf("INFO: User %d locked successfully.", userID)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
@@ -398,6 +434,13 @@ func UnlockUser(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		audit := util.Audit(r)
+		audit.Action = "user.unlock"
+		audit.TargetType = "user"
+		if before, err := db.GetUserByID(int(userID), pool); err == nil {
+			audit.Before = map[string]interface{}{"locked": before.Locked, "locked_until": before.LockedUntil}
+		}
+
 		err = db.UnlockUser(r.Context(), pool, userID)
 		if err != nil {
 			log.Printf("ERROR: Failed to unlock user %d: %v", userID, err)
@@ -405,6 +448,13 @@ func UnlockUser(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
+		err = db.ClearUserLoginFailures(r.Context(), pool, userID)
+		if err != nil {
+			log.Printf("ERROR: Failed to clear login failures for unlocked user %d: %v", userID, err)
+		}
+
+		audit.After = map[string]interface{}{"locked": false, "locked_until": nil}
+
 		log.Printf("INFO: User %d unlocked successfully.", userID)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
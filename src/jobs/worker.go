@@ -0,0 +1,140 @@
+// Package jobs runs the background jobs stored in the jobs table.
+package jobs
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Handler performs one job. A returned error schedules a retry.
+type Handler func(ctx context.Context, job *models.Job) error
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	Lease        time.Duration
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+}
+
+// WorkerPool claims due jobs and runs the handler registered for their kind.
+type WorkerPool struct {
+	pool     *pgxpool.Pool
+	config   Config
+	handlers map[string]Handler
+}
+
+func NewWorkerPool(pool *pgxpool.Pool, config Config) *WorkerPool {
+	return &WorkerPool{
+		pool:     pool,
+		config:   config,
+		handlers: make(map[string]Handler),
+	}
+}
+
+// Register sets the handler for a job kind. It must be called before Run.
+func (wp *WorkerPool) Register(kind string, handler Handler) {
+	wp.handlers[kind] = handler
+}
+
+// Run starts the workers and blocks until ctx is done and every running job has returned.
+func (wp *WorkerPool) Run(ctx context.Context) {
+	hostname, _ := os.Hostname()
+
+	var wg sync.WaitGroup
+	for i := 0; i < wp.config.Workers; i++ {
+		wg.Add(1)
+		go func(workerID string) {
+			defer wg.Done()
+			wp.work(ctx, workerID)
+		}(fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), i))
+	}
+	log.Printf("INFO: Started %d job workers", wp.config.Workers)
+	wg.Wait()
+}
+
+func (wp *WorkerPool) work(ctx context.Context, workerID string) {
+	for {
+		job, err := db.ClaimJob(ctx, wp.pool, workerID, wp.config.Lease)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("ERROR: Worker %s failed to claim job: %v", workerID, err)
+		}
+
+		// Go straight for the next job while there is work, otherwise wait for the next poll
+		if job != nil {
+			wp.runJob(ctx, workerID, job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wp.config.PollInterval):
+		}
+	}
+}
+
+func (wp *WorkerPool) runJob(ctx context.Context, workerID string, job *models.Job) {
+	// Results are recorded even while shutting down so the job is not left running until its lease expires
+	recordCtx := context.WithoutCancel(ctx)
+
+	err := wp.execute(ctx, job)
+	if err == nil {
+		if err := db.CompleteJob(recordCtx, wp.pool, job.ID, workerID); err != nil {
+			if errors.Is(err, db.ErrJobLeaseLost) {
+				log.Printf("ERROR: Job %d (%s) succeeded after its lease was lost, another worker now owns it", job.ID, job.Kind)
+				return
+			}
+			log.Printf("ERROR: %v", err)
+			return
+		}
+		log.Printf("INFO: Job %d (%s) succeeded after %d attempt(s)", job.ID, job.Kind, job.Attempts)
+		return
+	}
+
+	retryIn := util.ExponentialBackoff(job.Attempts, wp.config.BackoffBase, wp.config.BackoffMax)
+	status, recordErr := db.FailJob(recordCtx, wp.pool, job.ID, workerID, err, retryIn)
+	if errors.Is(recordErr, db.ErrJobLeaseLost) {
+		log.Printf("ERROR: Job %d (%s) failed after its lease was lost, another worker now owns it: %v", job.ID, job.Kind, err)
+		return
+	}
+	if recordErr != nil {
+		log.Printf("ERROR: %v", recordErr)
+		return
+	}
+	switch status {
+	case models.JobStatusDead:
+		log.Printf("ERROR: Job %d (%s) dead-lettered after %d attempt(s): %v", job.ID, job.Kind, job.Attempts, err)
+	case models.JobStatusCancelled:
+		log.Printf("INFO: Job %d (%s) failed and was superseded by a newer job: %v", job.ID, job.Kind, err)
+	default:
+		log.Printf("ERROR: Job %d (%s) attempt %d failed, retrying in %s: %v", job.ID, job.Kind, job.Attempts, retryIn, err)
+	}
+}
+
+// execute runs the job's handler within its lease, turning a panic into an ordinary failure
+func (wp *WorkerPool) execute(ctx context.Context, job *models.Job) (err error) {
+	handler, ok := wp.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for job kind %s", job.Kind)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	jobCtx, cancel := context.WithTimeout(ctx, wp.config.Lease)
+	defer cancel()
+	return handler(jobCtx, job)
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain text emails. Handlers depend on this interface so local development
+// can use LogMailer instead of a real SMTP server.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewMailer(driver string, smtpConfig SMTPConfig, logFile string) Mailer {
+	switch driver {
+	case "smtp":
+		if smtpConfig.Host == "" || smtpConfig.From == "" {
+			log.Fatal("SMTP_HOST and MAIL_FROM are required when MAIL_DRIVER is smtp")
+		}
+		return &SMTPMailer{config: smtpConfig}
+	case "log":
+		return &LogMailer{path: logFile}
+	case "":
+		// No default: falling back to the log driver would write live reset links to the log of a misconfigured deploy
+		log.Fatal("MAIL_DRIVER is required: smtp, or log for local development")
+	default:
+		log.Fatalf("Invalid mail driver: %s", driver)
+	}
+	return nil
+}
+
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	addr := m.config.Host + ":" + m.config.Port
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	msg := buildMessage(m.config.From, to, subject, body)
+
+	// net/smtp has no context support, so run the send in the background and honour cancellation here
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(addr, auth, m.config.From, []string{to}, msg)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("failed to send email via smtp: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer writes emails to a file, or to the application log when no file is configured.
+// It is intended for local development only.
+type LogMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	if m.path == "" {
+		log.Printf("INFO: Email (log mailer) - To: %s, Subject: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail log file: %w", err)
+	}
+	defer f.Close()
+
+	entry := fmt.Sprintf("=== %s ===\n%s\n", time.Now().UTC().Format(time.RFC3339), buildMessage("budgee@localhost", to, subject, body))
+	if _, err := f.WriteString(entry); err != nil {
+		return fmt.Errorf("failed to write mail log file: %w", err)
+	}
+	return nil
+}
+
+func buildMessage(from, to, subject, body string) []byte {
+	var sb strings.Builder
+	sb.WriteString("From: " + from + "\r\n")
+	sb.WriteString("To: " + to + "\r\n")
+	sb.WriteString("Subject: " + subject + "\r\n")
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(body)
+	return []byte(sb.String())
+}
@@ -5,13 +5,38 @@ import (
 	"budgee-server/src/config"
 	"budgee-server/src/db"
 	sql "budgee-server/src/db"
+	dbsql "budgee-server/src/db/sql"
+	"budgee-server/src/handlers"
+	"budgee-server/src/jobs"
+	"budgee-server/src/mailer"
+	"budgee-server/src/models"
 	plaidclient "budgee-server/src/plaid"
+	"budgee-server/src/util"
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout bounds how long in-flight HTTP requests get to finish after a shutdown signal
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// Admin command: print a fresh JWT signing key, needed before the server can be configured
+	if len(os.Args) > 1 && os.Args[1] == "generate-jwt-key" {
+		key, err := util.GenerateJWTKey()
+		if err != nil {
+			log.Fatalf("Generating JWT key failed: %v", err)
+		}
+		fmt.Println(key)
+		return
+	}
+
 	cfg := config.Load()
 
 	logFile, err := os.OpenFile("/var/log/budgee-api.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -24,7 +49,7 @@ func main() {
 	}
 
 	// Connect to database
-	pool, err := sql.Connect(cfg.DatabaseURL)
+	pool, err := sql.Connect(cfg.DatabaseURL, int32(cfg.DatabaseMaxConns))
 	if err != nil {
 		log.Fatalf("DB connection failed: %v", err)
 	}
@@ -33,14 +58,99 @@ func main() {
 	// Initialize Cache
 	db.InitCache()
 
+	// Initialize Encryption
+	if err := util.InitEncryption(cfg.EncryptionKeys, cfg.EncryptionKeyID); err != nil {
+		log.Fatalf("Encryption setup failed: %v", err)
+	}
+
+	// Only believe forwarding headers set by our own reverse proxy
+	if err := util.InitTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Trusted proxy setup failed: %v", err)
+	}
+
+	// Initialize JWT Keys
+	if err := util.InitJWTKeys(cfg.JWTSigningKeys, cfg.JWTVerifyKeys, cfg.JWTActiveKeyID); err != nil {
+		log.Fatalf("JWT key setup failed: %v", err)
+	}
+
+	// Admin command: re-encrypt stored Plaid access tokens and TOTP secrets with the active key after a rotation
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt-tokens" {
+		count, err := dbsql.ReencryptPlaidAccessTokens(context.Background(), pool)
+		if err != nil {
+			log.Fatalf("Re-encrypting access tokens failed: %v", err)
+		}
+		log.Printf("INFO: Re-encrypted %d plaid access tokens with key %s", count, cfg.EncryptionKeyID)
+		count, err = dbsql.ReencryptTOTPSecrets(context.Background(), pool)
+		if err != nil {
+			log.Fatalf("Re-encrypting TOTP secrets failed: %v", err)
+		}
+		log.Printf("INFO: Re-encrypted %d TOTP secrets with key %s", count, cfg.EncryptionKeyID)
+		return
+	}
+
 	// Initialize Plaid Client
 	plaidClient := plaidclient.NewPlaidClient(cfg.PlaidClientID, cfg.PlaidSecret, cfg.PlaidEnvironment)
 
+	// Initialize Mailer
+	mail := mailer.NewMailer(cfg.MailDriver, mailer.SMTPConfig{
+		Host:     cfg.SMTPHost,
+		Port:     cfg.SMTPPort,
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.MailFrom,
+	}, cfg.MailLogFile)
+
+	// Stop taking new work on SIGINT/SIGTERM and let what is running finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
+
+	// Background job workers
+	workers := jobs.NewWorkerPool(pool, jobs.Config(cfg.Jobs))
+	workers.Register(models.JobKindSyncItem, handlers.SyncItemJob(plaidClient, pool))
+	workers.Register(models.JobKindSyncHoldings, handlers.SyncHoldingsJob(plaidClient, pool))
+	workers.Register(models.JobKindSyncInvestmentTransactions, handlers.SyncInvestmentTransactionsJob(plaidClient, pool))
+	workers.Register(models.JobKindSyncLiabilities, handlers.SyncLiabilitiesJob(plaidClient, pool))
+	workers.Register(models.JobKindDetectRecurring, handlers.DetectRecurringJob(plaidClient, pool, cfg.PlaidRecurring))
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		workers.Run(ctx)
+	}()
+
+	// Periodically sync items in case webhooks were missed
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		handlers.RunSyncScheduler(ctx, plaidClient, pool, cfg.SyncSchedule)
+	}()
+
+	// Purge accounts whose deletion grace period has passed
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		handlers.RunScheduledAccountDeletions(ctx, plaidClient, pool, time.Hour)
+	}()
+
 	// Router
-	router := api.NewRouter(pool, plaidClient, cfg.PlaidEnvironment, cfg.IsDemo)
+	router := api.NewRouter(pool, plaidClient, mail, cfg)
+	server := &http.Server{Addr: "127.0.0.1:" + cfg.Port, Handler: router}
+
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down, waiting for in-flight requests and jobs...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("ERROR: HTTP server shutdown: %v", err)
+		}
+	}()
 
 	log.Println("API server running on port", cfg.Port)
-	if err := http.ListenAndServe("127.0.0.1:"+cfg.Port, router); err != nil {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
+
+	background.Wait()
+	log.Println("API server stopped")
 }
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	db "budgee-server/src/db/sql"
+	"budgee-server/src/models"
+	"budgee-server/src/util"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// How long writing an audit event may take once the request has finished
+const auditWriteTimeout = 5 * time.Second
+
+// statusRecorder remembers the status code a handler wrote so it can be stored with the audit event.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// AuditMiddleware writes an audit event for every state-changing request, including rejected ones.
+// The action defaults to the method and route pattern and the target to the route's URL parameter;
+// handlers refine both and add before/after snapshots through util.Audit. Reads are not audited.
+func AuditMiddleware(pool *pgxpool.Pool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, details := util.WithAuditDetails(r.Context())
+			recorder := &statusRecorder{ResponseWriter: w}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(recorder, r)
+
+			event := models.AuditEvent{
+				Action:     details.Action,
+				StatusCode: recorder.status,
+			}
+			if event.StatusCode == 0 {
+				event.StatusCode = http.StatusOK
+			}
+
+			routeCtx := chi.RouteContext(r.Context())
+			if event.Action == "" && routeCtx != nil {
+				event.Action = r.Method + " " + routeCtx.RoutePattern()
+			}
+			if details.TargetType != "" {
+				event.TargetType = &details.TargetType
+			}
+			if details.TargetID != "" {
+				event.TargetID = &details.TargetID
+			} else if routeCtx != nil && len(routeCtx.URLParams.Values) > 0 {
+				targetID := routeCtx.URLParams.Values[len(routeCtx.URLParams.Values)-1]
+				event.TargetID = &targetID
+			}
+
+			if userID, ok := r.Context().Value("user_id").(int64); ok {
+				event.ActorUserID = &userID
+			}
+			if username, ok := r.Context().Value("username").(string); ok {
+				event.ActorUsername = &username
+			}
+			ip := util.ClientIP(r)
+			event.IPAddress = &ip
+			if ua := r.UserAgent(); ua != "" {
+				event.UserAgent = &ua
+			}
+
+			event.Before = marshalAuditSnapshot(details.Before)
+			event.After = marshalAuditSnapshot(details.After)
+
+			// The response has already been sent, so a failed write can only be logged. The client may have
+			// disconnected by now, which must not cancel the write.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), auditWriteTimeout)
+			defer cancel()
+			if err := db.InsertAuditEvent(ctx, pool, event); err != nil {
+				log.Printf("ERROR: Failed to write audit event %s: %v", event.Action, err)
+			}
+		})
+	}
+}
+
+func marshalAuditSnapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("ERROR: Failed to marshal audit snapshot: %v", err)
+		return nil
+	}
+	return data
+}
@@ -2,10 +2,11 @@ package middleware
 
 import (
 	db "budgee-server/src/db/sql"
+	"budgee-server/src/util"
 	"context"
 	"fmt"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -21,50 +22,70 @@ func ParseTokenFromRequest(r *http.Request) (jwt.MapClaims, error) {
 
 	tokenString = strings.TrimPrefix(tokenString, "Bearer ")
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid signing method")
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
-
-	if err != nil || !token.Valid {
-		return nil, fmt.Errorf("invalid token")
-	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
-	}
-
-	return nil, fmt.Errorf("invalid token claims")
+	return util.ParseJWT(tokenString)
 }
 
 func JWTAuthMiddleware(pool *pgxpool.Pool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Personal API tokens are opaque and carry a fixed prefix, everything else is treated as a JWT
+			if rawToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); strings.HasPrefix(rawToken, util.APITokenPrefix) {
+				serveWithAPIToken(pool, rawToken, next, w, r)
+				return
+			}
+
 			claims, err := ParseTokenFromRequest(r)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
 
-			username := claims["username"].(string)
-			userID := claims["user_id"].(float64)
+			// A pending MFA token only proves the password step and is accepted solely by /api/login/mfa
+			if pending, _ := claims["mfa_pending"].(bool); pending {
+				http.Error(w, "two-factor authentication required", http.StatusUnauthorized)
+				return
+			}
+			// Single-purpose tokens such as email verification links are never access tokens
+			if _, ok := claims["purpose"]; ok {
+				http.Error(w, "invalid token claims", http.StatusUnauthorized)
+				return
+			}
+
+			username, _ := claims["username"].(string)
+			userID, _ := claims["user_id"].(float64)
 			superAdmin := false
 			if v, ok := claims["super_admin"].(bool); ok {
 				superAdmin = v
 			}
 
+			sessionID, ok := claims["sid"].(float64)
+			if !ok {
+				http.Error(w, "invalid token claims", http.StatusUnauthorized)
+				return
+			}
+
+			// Check the session has not been revoked by a logout or token reuse
+			active, err := db.IsSessionActive(r.Context(), pool, int64(sessionID), int64(userID))
+			if err != nil || !active {
+				http.Error(w, "session has been revoked", http.StatusUnauthorized)
+				return
+			}
+
 			// Check if user is locked
 			user, err := db.GetUserByID(int(userID), pool)
 			if err == nil && user.Locked {
 				http.Error(w, "user account is locked", http.StatusForbidden)
 				return
 			}
+			mfaEnabled := err == nil && user.TOTPEnabled
+			emailVerified := err == nil && user.EmailVerifiedAt != nil
 
 			ctx := context.WithValue(r.Context(), "username", username)
 			ctx = context.WithValue(ctx, "user_id", int64(userID))
 			ctx = context.WithValue(ctx, "super_admin", superAdmin)
+			ctx = context.WithValue(ctx, "session_id", int64(sessionID))
+			ctx = context.WithValue(ctx, "mfa_enabled", mfaEnabled)
+			ctx = context.WithValue(ctx, "email_verified", emailVerified)
 
 			r = r.WithContext(ctx)
 			next.ServeHTTP(w, r)
@@ -72,11 +93,67 @@ func JWTAuthMiddleware(pool *pgxpool.Pool) func(http.Handler) http.Handler {
 	}
 }
 
-func SuperAdminMiddleware(next http.Handler) http.Handler {
+// serveWithAPIToken authenticates a personal API token. Requests made with one never carry admin rights
+// and are limited to the token's scopes by RequireScope.
+func serveWithAPIToken(pool *pgxpool.Pool, rawToken string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	token, err := db.AuthenticateAPIToken(r.Context(), pool, util.HashToken(rawToken), util.ClientIP(r))
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := db.GetUserByID(int(token.UserID), pool)
+	if err != nil {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if user.Locked {
+		http.Error(w, "user account is locked", http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), "username", user.Username)
+	ctx = context.WithValue(ctx, "user_id", token.UserID)
+	ctx = context.WithValue(ctx, "super_admin", false)
+	ctx = context.WithValue(ctx, "mfa_enabled", false)
+	ctx = context.WithValue(ctx, "email_verified", user.EmailVerifiedAt != nil)
+	ctx = context.WithValue(ctx, "api_token_id", token.ID)
+	ctx = context.WithValue(ctx, "api_token_scopes", token.Scopes)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// RequireScope restricts API token requests to tokens granted the given scope. Interactive sessions are not scoped.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, isAPIToken := r.Context().Value("api_token_scopes").([]string)
+			if isAPIToken && !slices.Contains(scopes, scope) {
+				http.Error(w, "token is missing required scope "+scope, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnlyMiddleware rejects API tokens on routes that manage the account itself, such as passwords,
+// two-factor settings, linked institutions and the API tokens themselves.
+func SessionOnlyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, isAPIToken := r.Context().Value("api_token_scopes").([]string); isAPIToken {
+			http.Error(w, "this endpoint requires an interactive session", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// VerifiedEmailMiddleware keeps accounts with an unconfirmed email to account management routes until they verify it.
+func VerifiedEmailMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		superAdmin, ok := r.Context().Value("super_admin").(bool)
-		if !ok || !superAdmin {
-			http.Error(w, "forbidden", http.StatusForbidden)
+		if verified, _ := r.Context().Value("email_verified").(bool); !verified {
+			http.Error(w, "email address has not been verified", http.StatusForbidden)
 			return
 		}
 		next.ServeHTTP(w, r)
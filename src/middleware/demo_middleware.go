@@ -6,9 +6,13 @@ import (
 
 func DemoModeMiddleware(isDemo bool) func(http.Handler) http.Handler {
 	allowedPosts := map[string]bool{
-		"/api/login":         true,
-		"/api/register":      true,
-		"/api/plaid/webhook": true,
+		"/api/login":                   true,
+		"/api/login/mfa":               true,
+		"/api/register":                true,
+		"/api/plaid/webhook":           true,
+		"/api/logout":                  true,
+		"/api/logout/all":              true,
+		"/api/user/email/verification": true,
 	}
 
 	return func(next http.Handler) http.Handler {
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	db "budgee-server/src/db/sql"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StaffMiddleware admits users holding at least one admin permission, either through a role or super_admin,
+// and loads their permissions for RequirePermission. It must run after JWTAuthMiddleware.
+func StaffMiddleware(pool *pgxpool.Pool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// API tokens never reach admin routes, even when their owner is staff
+			if _, isAPIToken := r.Context().Value("api_token_scopes").([]string); isAPIToken {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			userID := r.Context().Value("user_id").(int64)
+			permissions, err := db.GetUserPermissions(r.Context(), pool, userID)
+			if err != nil {
+				log.Printf("ERROR: Failed to load permissions for user %d: %v", userID, err)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			if len(permissions) == 0 {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			// Staff must have two-factor authentication enrolled before admin routes work for them
+			mfaEnabled, ok := r.Context().Value("mfa_enabled").(bool)
+			if !ok || !mfaEnabled {
+				http.Error(w, "two-factor authentication must be enabled for admin access", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "permissions", permissions)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequirePermission rejects requests whose user lacks the given permission. It must run after StaffMiddleware.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			permissions, _ := r.Context().Value("permissions").([]string)
+			if !slices.Contains(permissions, permission) {
+				http.Error(w, "missing permission "+permission, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
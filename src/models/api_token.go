@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Scopes that can be granted to a personal API token
+const (
+	ScopeAccountsRead      = "accounts:read"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeBudgetsRead       = "budgets:read"
+	ScopeBudgetsWrite      = "budgets:write"
+	ScopeRulesRead         = "rules:read"
+	ScopeRulesWrite        = "rules:write"
+	ScopeInvestmentsRead   = "investments:read"
+	ScopeLiabilitiesRead   = "liabilities:read"
+)
+
+var APITokenScopes = []string{
+	ScopeAccountsRead,
+	ScopeTransactionsRead,
+	ScopeTransactionsWrite,
+	ScopeBudgetsRead,
+	ScopeBudgetsWrite,
+	ScopeRulesRead,
+	ScopeRulesWrite,
+	ScopeInvestmentsRead,
+	ScopeLiabilitiesRead,
+}
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
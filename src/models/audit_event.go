@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEvent struct {
+	ID            int64           `json:"id"`
+	ActorUserID   *int64          `json:"actor_user_id"`
+	ActorUsername *string         `json:"actor_username"`
+	Action        string          `json:"action"`
+	TargetType    *string         `json:"target_type"`
+	TargetID      *string         `json:"target_id"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+	StatusCode    int             `json:"status_code"`
+	IPAddress     *string         `json:"ip_address"`
+	UserAgent     *string         `json:"user_agent"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// AuditEventFilter narrows an audit log query. Zero values are ignored.
+type AuditEventFilter struct {
+	ActorUserID int64
+	Action      string
+	TargetType  string
+	TargetID    string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+	Offset      int
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// Security is a stock, fund, bond or other instrument, shared by every holding of it
+type Security struct {
+	ID               int        `json:"id"`
+	SecurityID       string     `json:"security_id"`
+	Name             *string    `json:"name"`
+	TickerSymbol     *string    `json:"ticker_symbol"`
+	Type             *string    `json:"type"`
+	Subtype          *string    `json:"subtype"`
+	IsCashEquivalent bool       `json:"is_cash_equivalent"`
+	ClosePrice       *float64   `json:"close_price"`
+	ClosePriceAsOf   *time.Time `json:"close_price_as_of"`
+	Currency         *string    `json:"currency"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// Holding is the position in one security held by an account on SnapshotDate
+type Holding struct {
+	ID               int       `json:"id"`
+	AccountID        int       `json:"account_id"`
+	SecurityID       int       `json:"security_id"`
+	SnapshotDate     time.Time `json:"snapshot_date"`
+	Quantity         float64   `json:"quantity"`
+	InstitutionPrice float64   `json:"institution_price"`
+	InstitutionValue float64   `json:"institution_value"`
+	CostBasis        *float64  `json:"cost_basis"`
+	Currency         *string   `json:"currency"`
+	CreatedAt        time.Time `json:"created_at"`
+
+	SecurityName *string `json:"security_name"`
+	TickerSymbol *string `json:"ticker_symbol"`
+	SecurityType *string `json:"security_type"`
+}
+
+type InvestmentTransaction struct {
+	ID                      int       `json:"id"`
+	AccountID               int       `json:"account_id"`
+	InvestmentTransactionID string    `json:"investment_transaction_id"`
+	SecurityID              *int      `json:"security_id"`
+	Date                    time.Time `json:"date"`
+	Name                    string    `json:"name"`
+	Quantity                float64   `json:"quantity"`
+	Amount                  float64   `json:"amount"`
+	Price                   float64   `json:"price"`
+	Fees                    *float64  `json:"fees"`
+	Type                    string    `json:"type"`
+	Subtype                 string    `json:"subtype"`
+	Currency                *string   `json:"currency"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
+}
+
+// AccountPortfolioValue is the value of an investment account's latest holdings snapshot
+type AccountPortfolioValue struct {
+	AccountID    int       `json:"account_id"`
+	AccountName  string    `json:"account_name"`
+	SnapshotDate time.Time `json:"snapshot_date"`
+	Value        float64   `json:"value"`
+}
+
+// AllocationSlice is the share of the portfolio held in one security type
+type AllocationSlice struct {
+	SecurityType string  `json:"security_type"`
+	Value        float64 `json:"value"`
+	Percentage   float64 `json:"percentage"`
+}
+
+// AccountCostBasis compares what was paid for an account's holdings with what they are worth. Holdings
+// without a reported cost basis are counted in UnknownCostBasisValue instead of the gain.
+type AccountCostBasis struct {
+	AccountID             int     `json:"account_id"`
+	AccountName           string  `json:"account_name"`
+	CostBasis             float64 `json:"cost_basis"`
+	Value                 float64 `json:"value"`
+	Gain                  float64 `json:"gain"`
+	UnknownCostBasisValue float64 `json:"unknown_cost_basis_value"`
+}
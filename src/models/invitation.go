@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type Invitation struct {
+	ID         int64      `json:"id"`
+	Email      *string    `json:"email"`
+	Role       *string    `json:"role"`
+	InvitedBy  *int64     `json:"invited_by"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RedeemedAt *time.Time `json:"redeemed_at"`
+	RedeemedBy *int64     `json:"redeemed_by"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
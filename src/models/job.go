@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+	JobStatusCancelled = "cancelled"
+)
+
+// Job kinds
+const (
+	JobKindSyncItem                   = "sync_item"
+	JobKindSyncHoldings               = "sync_holdings"
+	JobKindSyncInvestmentTransactions = "sync_investment_transactions"
+	JobKindSyncLiabilities            = "sync_liabilities"
+	JobKindDetectRecurring            = "detect_recurring"
+)
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	DedupKey    *string         `json:"dedup_key"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedAt    *time.Time      `json:"locked_at"`
+	LockedBy    *string         `json:"locked_by"`
+	LastError   *string         `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+}
+
+type JobFilter struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+// SyncItemPayload is the payload of the item sync jobs. ItemID is Plaid's item_id.
+type SyncItemPayload struct {
+	ItemID string `json:"item_id"`
+}
+
+// DetectRecurringPayload is the payload of JobKindDetectRecurring jobs
+type DetectRecurringPayload struct {
+	UserID int64 `json:"user_id"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Liability types, matching the groups Plaid returns them in
+const (
+	LiabilityTypeCredit   = "credit"
+	LiabilityTypeStudent  = "student"
+	LiabilityTypeMortgage = "mortgage"
+)
+
+// Liability holds the loan or credit card details of an account. Fields shared by every type are columns,
+// the rest of what Plaid reports for the type, such as a credit card's APRs, is kept in Details.
+type Liability struct {
+	ID                         int             `json:"id"`
+	AccountID                  int             `json:"account_id"`
+	PlaidAccountID             string          `json:"-"`
+	Type                       string          `json:"type"`
+	InterestRatePercentage     *float64        `json:"interest_rate_percentage"`
+	InterestRateType           *string         `json:"interest_rate_type"`
+	MinimumPaymentAmount       *float64        `json:"minimum_payment_amount"`
+	NextPaymentDueDate         *time.Time      `json:"next_payment_due_date"`
+	LastPaymentAmount          *float64        `json:"last_payment_amount"`
+	LastPaymentDate            *time.Time      `json:"last_payment_date"`
+	LastStatementBalance       *float64        `json:"last_statement_balance"`
+	LastStatementIssueDate     *time.Time      `json:"last_statement_issue_date"`
+	IsOverdue                  *bool           `json:"is_overdue"`
+	OriginationDate            *time.Time      `json:"origination_date"`
+	OriginationPrincipalAmount *float64        `json:"origination_principal_amount"`
+	PayoffDate                 *time.Time      `json:"payoff_date"`
+	LoanTerm                   *string         `json:"loan_term"`
+	LoanName                   *string         `json:"loan_name"`
+	Details                    json.RawMessage `json:"details"`
+	UpdatedAt                  time.Time       `json:"updated_at"`
+
+	AccountName    string  `json:"account_name"`
+	CurrentBalance float64 `json:"current_balance"`
+}
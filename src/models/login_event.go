@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type LoginEvent struct {
+	ID                int64     `json:"id"`
+	UserID            *int64    `json:"user_id"`
+	Identifier        *string   `json:"identifier"`
+	Success           bool      `json:"success"`
+	FailureReason     *string   `json:"failure_reason"`
+	IPAddress         *string   `json:"ip_address"`
+	IPRange           *string   `json:"ip_range"`
+	UserAgent         *string   `json:"user_agent"`
+	DeviceFingerprint *string   `json:"device_fingerprint"`
+	NewDevice         bool      `json:"new_device"`
+	NewIPRange        bool      `json:"new_ip_range"`
+	CreatedAt         time.Time `json:"created_at"`
+}
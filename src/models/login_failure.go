@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type LoginFailure struct {
+	ID            int64     `json:"id"`
+	UserID        *int64    `json:"user_id"`
+	IPAddress     *string   `json:"ip_address"`
+	FailureCount  int       `json:"failure_count"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
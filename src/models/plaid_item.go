@@ -2,6 +2,15 @@ package models
 
 import "time"
 
+// Item health statuses, kept up to date from Plaid ITEM webhooks
+const (
+	ItemStatusActive            = "active"
+	ItemStatusError             = "error"
+	ItemStatusPendingExpiration = "pending_expiration"
+	ItemStatusPendingDisconnect = "pending_disconnect"
+	ItemStatusRevoked           = "revoked"
+)
+
 type PlaidItem struct {
 	ID              string    `json:"id"`
 	UserID          int64     `json:"user_id"`
@@ -10,4 +19,11 @@ type PlaidItem struct {
 	InstitutionID   string    `json:"institution_id"`
 	InstitutionName string    `json:"institution_name"`
 	CreatedAt       time.Time `json:"created_at"`
+
+	Status                string     `json:"status"`
+	ErrorCode             *string    `json:"error_code"`
+	ErrorMessage          *string    `json:"error_message"`
+	ConsentExpirationTime *time.Time `json:"consent_expiration_time"`
+	NewAccountsAvailable  bool       `json:"new_accounts_available"`
+	StatusUpdatedAt       *time.Time `json:"status_updated_at"`
 }
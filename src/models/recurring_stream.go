@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Where a recurring stream came from
+const (
+	RecurringSourceDetected = "detected"
+	RecurringSourcePlaid    = "plaid"
+)
+
+// Recurring stream directions, following Plaid's sign convention of positive amounts leaving the account
+const (
+	RecurringDirectionOutflow = "outflow"
+	RecurringDirectionInflow  = "inflow"
+)
+
+const (
+	RecurringStatusActive    = "active"
+	RecurringStatusCancelled = "cancelled"
+)
+
+const (
+	RecurringFrequencyWeekly      = "weekly"
+	RecurringFrequencyBiweekly    = "biweekly"
+	RecurringFrequencySemiMonthly = "semi_monthly"
+	RecurringFrequencyMonthly     = "monthly"
+	RecurringFrequencyQuarterly   = "quarterly"
+	RecurringFrequencyAnnually    = "annually"
+)
+
+// RecurringStream is a series of transactions that repeat on a cadence, such as a subscription, a bill or a
+// paycheck. PreviousAmount and PriceChangedOn are set when a fixed amount changed.
+type RecurringStream struct {
+	ID               int        `json:"id"`
+	UserID           int64      `json:"user_id"`
+	AccountID        int        `json:"account_id"`
+	AccountName      string     `json:"account_name"`
+	Source           string     `json:"source"`
+	PlaidStreamID    *string    `json:"plaid_stream_id"`
+	MerchantKey      string     `json:"merchant_key"`
+	MerchantName     string     `json:"merchant_name"`
+	Category         *string    `json:"category"`
+	Direction        string     `json:"direction"`
+	Frequency        string     `json:"frequency"`
+	AverageAmount    float64    `json:"average_amount"`
+	LastAmount       float64    `json:"last_amount"`
+	PreviousAmount   *float64   `json:"previous_amount"`
+	PriceChangedOn   *time.Time `json:"price_changed_on"`
+	FirstDate        time.Time  `json:"first_date"`
+	LastDate         time.Time  `json:"last_date"`
+	NextExpectedDate *time.Time `json:"next_expected_date"`
+	TransactionCount int        `json:"transaction_count"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// ExpectedCharge is one upcoming occurrence of a recurring stream
+type ExpectedCharge struct {
+	StreamID     int       `json:"stream_id"`
+	AccountID    int       `json:"account_id"`
+	AccountName  string    `json:"account_name"`
+	MerchantName string    `json:"merchant_name"`
+	Category     *string   `json:"category"`
+	Direction    string    `json:"direction"`
+	Frequency    string    `json:"frequency"`
+	Date         time.Time `json:"date"`
+	Amount       float64   `json:"amount"`
+	Overdue      bool      `json:"overdue"`
+}
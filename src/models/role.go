@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Admin permissions, granted through roles
+const (
+	PermUsersRead         = "users:read"
+	PermUsersWrite        = "users:write"
+	PermUsersDelete       = "users:delete"
+	PermItemsRead         = "items:read"
+	PermItemsWrite        = "items:write"
+	PermItemsDelete       = "items:delete"
+	PermSyncTrigger       = "sync:trigger"
+	PermCacheClear        = "cache:clear"
+	PermInvitationsManage = "invitations:manage"
+	PermRolesManage       = "roles:manage"
+	PermAuditRead         = "audit:read"
+	PermJobsManage        = "jobs:manage"
+)
+
+var AllPermissions = []string{
+	PermUsersRead,
+	PermUsersWrite,
+	PermUsersDelete,
+	PermItemsRead,
+	PermItemsWrite,
+	PermItemsDelete,
+	PermSyncTrigger,
+	PermCacheClear,
+	PermInvitationsManage,
+	PermRolesManage,
+	PermAuditRead,
+	PermJobsManage,
+}
+
+type Role struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
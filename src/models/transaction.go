@@ -2,6 +2,18 @@ package models
 
 import "time"
 
+// OverridableTransactionFields are the fields a user can edit on a transaction. Once edited, Plaid syncs and
+// transaction rules leave the field alone until the user resets it.
+var OverridableTransactionFields = []string{
+	"amount",
+	"primary_category",
+	"detailed_category",
+	"merchant_name",
+	"date",
+	"payment_channel",
+	"personal_finance_category_icon_url",
+}
+
 type Transaction struct {
 	ID                             int       `json:"id"`
 	AccountID                      int       `json:"account_id"`
@@ -22,4 +34,21 @@ type Transaction struct {
 	UpdatedAt                      time.Time `json:"updated_at"`
 	PaymentChannel                 *string   `json:"payment_channel"`
 	PersonalFinanceCategoryIconURL *string   `json:"personal_finance_category_icon_url"`
+	UserOverriddenFields           []string  `json:"user_overridden_fields"`
+
+	// Set on a posted transaction that replaced a pending one
+	PendingTransactionID *string                     `json:"pending_transaction_id"`
+	PendingTransaction   *PendingTransactionSnapshot `json:"pending_transaction"`
+}
+
+// PendingTransactionSnapshot is the pending version of a transaction as it was when Plaid replaced it with
+// the posted one.
+type PendingTransactionSnapshot struct {
+	TransactionID   string    `json:"transaction_id"`
+	Name            string    `json:"name"`
+	MerchantName    *string   `json:"merchant_name"`
+	Amount          float64   `json:"amount"`
+	Date            string    `json:"date"`
+	PrimaryCategory *string   `json:"primary_category"`
+	CreatedAt       time.Time `json:"created_at"`
 }
@@ -14,4 +14,12 @@ type User struct {
 	SuperAdmin   bool       `json:"super_admin"`
 	LastLogin    *time.Time `json:"last_login"`
 	Locked       bool       `json:"locked"`
+	LockedUntil  *time.Time `json:"locked_until"`
+	TOTPEnabled  bool       `json:"totp_enabled"`
+	TOTPSecret   *string    `json:"-"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PendingEmail    *string    `json:"pending_email"`
+
+	DeletionScheduledFor *time.Time `json:"deletion_scheduled_for"`
 }
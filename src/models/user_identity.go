@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+type UserIdentity struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       *string    `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OIDCLoginState is the server side half of an authorization request started at an identity provider.
+type OIDCLoginState struct {
+	Provider       string
+	Nonce          string
+	CodeVerifier   string
+	InviteCodeHash *string
+}
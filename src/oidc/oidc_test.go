@@ -0,0 +1,242 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "budgee-test-client"
+	testKid      = "test-key"
+)
+
+// mockProvider is a minimal OpenID Connect provider serving discovery, JWKS and the token endpoint. The token
+// endpoint only redeems codes registered with the PKCE challenge they were issued for.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu         sync.Mutex
+	challenges map[string]string
+	idToken    string
+	tokenForm  url.Values
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+	m := &mockProvider{t: t, key: key, challenges: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": testKid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid_request", http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.tokenForm = r.PostForm
+
+		challenge, ok := m.challenges[r.PostForm.Get("code")]
+		if !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost/callback",
+	})
+}
+
+// claims returns valid ID token claims for the nonce, to be altered by each test
+func (m *mockProvider) claims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func (m *mockProvider) sign(claims jwt.MapClaims, kid string) string {
+	m.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		m.t.Fatalf("failed to sign id token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthCodeFlowUsesPKCES256(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization URL %q: %v", authURL, err)
+	}
+	q := parsed.Query()
+	if got := q.Get("code_challenge_method"); got != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", got)
+	}
+	sum := sha256.Sum256([]byte("verifier-1"))
+	if got, want := q.Get("code_challenge"), base64.RawURLEncoding.EncodeToString(sum[:]); got != want {
+		t.Fatalf("code_challenge = %q, want %q", got, want)
+	}
+	if q.Get("nonce") != "nonce-1" || q.Get("state") != "state-1" || q.Get("client_id") != testClientID {
+		t.Fatalf("authorization URL is missing state, nonce or client_id: %s", authURL)
+	}
+
+	m.challenges["code-1"] = q.Get("code_challenge")
+	m.idToken = m.sign(m.claims("nonce-1"), testKid)
+
+	rawIDToken, err := p.Exchange(ctx, "code-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if m.tokenForm.Get("code_verifier") != "verifier-1" {
+		t.Fatalf("token request sent code_verifier %q", m.tokenForm.Get("code_verifier"))
+	}
+	claims, err := p.VerifyIDToken(ctx, rawIDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken rejected a valid token: %v", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	if _, err := p.Exchange(ctx, "code-1", "another-verifier"); err == nil {
+		t.Fatal("Exchange succeeded with a code verifier that does not match the challenge")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.provider()
+
+	tests := []struct {
+		name   string
+		alter  func(claims jwt.MapClaims)
+		kid    string
+		nonce  string
+		errSub string
+	}{
+		{
+			name:   "wrong nonce",
+			nonce:  "someone-elses-nonce",
+			errSub: "nonce",
+		},
+		{
+			name:   "wrong issuer",
+			alter:  func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+			errSub: "issuer",
+		},
+		{
+			name:   "wrong audience",
+			alter:  func(c jwt.MapClaims) { c["aud"] = "another-client" },
+			errSub: "audience",
+		},
+		{
+			name: "expired token",
+			alter: func(c jwt.MapClaims) {
+				c["iat"] = time.Now().Add(-time.Hour).Unix()
+				c["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+			},
+			errSub: "expired",
+		},
+		{
+			name:   "unknown kid",
+			kid:    "rotated-away",
+			errSub: "no signing key",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := m.claims("nonce-1")
+			if tc.alter != nil {
+				tc.alter(claims)
+			}
+			kid := testKid
+			if tc.kid != "" {
+				kid = tc.kid
+			}
+			nonce := "nonce-1"
+			if tc.nonce != "" {
+				nonce = tc.nonce
+			}
+
+			_, err := p.VerifyIDToken(context.Background(), m.sign(claims, kid), nonce)
+			if err == nil {
+				t.Fatal("VerifyIDToken accepted the token")
+			}
+			if !strings.Contains(err.Error(), tc.errSub) {
+				t.Fatalf("error %q does not mention %q", err, tc.errSub)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package util
+
+import (
+	"context"
+	"net/http"
+)
+
+// AuditDetails is attached to admin requests by the audit middleware. Handlers fill in what only they know,
+// such as the state of the target before and after the change; the middleware writes the event once the
+// handler returns.
+type AuditDetails struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// WithAuditDetails returns a context carrying a fresh AuditDetails for the handler to fill in.
+func WithAuditDetails(ctx context.Context) (context.Context, *AuditDetails) {
+	details := &AuditDetails{}
+	return context.WithValue(ctx, "audit", details), details
+}
+
+// Audit returns the request's AuditDetails. Outside an audited route it returns a throwaway value,
+// so handlers can record details unconditionally.
+func Audit(r *http.Request) *AuditDetails {
+	if details, ok := r.Context().Value("audit").(*AuditDetails); ok {
+		return details
+	}
+	return &AuditDetails{}
+}
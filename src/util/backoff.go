@@ -0,0 +1,21 @@
+package util
+
+import "time"
+
+// ExponentialBackoff returns base * 2^(attempt-1), capped at max. Attempts below one return zero.
+func ExponentialBackoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max || delay <= 0 {
+			return max
+		}
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
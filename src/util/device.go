@@ -0,0 +1,34 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DeviceFingerprint derives a stable identifier for the client software from headers a browser or app
+// sends on every request. It is not meant to be unforgeable, only to tell a user's usual devices apart.
+func DeviceFingerprint(r *http.Request) string {
+	parts := []string{
+		strings.TrimSpace(r.UserAgent()),
+		strings.TrimSpace(r.Header.Get("Accept-Language")),
+		strings.TrimSpace(r.Header.Get("Sec-CH-UA-Platform")),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// IPRange returns the network an address belongs to: its /24 for IPv4 and /48 for IPv6.
+// Addresses that cannot be parsed are returned unchanged.
+func IPRange(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
@@ -0,0 +1,170 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Secrets are stored as enc:v1:<key id>:<wrapped data key>:<ciphertext>. Each value gets its own random
+// data key, which is itself encrypted with the master key named by <key id>. Rotating master keys only
+// requires re-wrapping values, and old keys stay usable for decryption until every value is rotated.
+const encryptedSecretPrefix = "enc:v1:"
+
+type keyring struct {
+	keys     map[string][]byte
+	activeID string
+}
+
+var encryptionKeys *keyring
+
+// InitEncryption loads master keys from a spec of the form "kid1:base64key,kid2:base64key".
+// Every key must decode to 32 bytes (AES-256). New values are always encrypted with activeKeyID.
+func InitEncryption(spec string, activeKeyID string) error {
+	ring := &keyring{keys: make(map[string][]byte), activeID: activeKeyID}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" {
+			return fmt.Errorf("invalid encryption key entry %q, expected kid:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("invalid base64 for encryption key %q: %w", kid, err)
+		}
+		if len(key) != 32 {
+			return fmt.Errorf("encryption key %q must be 32 bytes, got %d", kid, len(key))
+		}
+		ring.keys[kid] = key
+	}
+
+	if len(ring.keys) == 0 {
+		return errors.New("no encryption keys configured")
+	}
+	if _, ok := ring.keys[activeKeyID]; !ok {
+		return fmt.Errorf("active encryption key %q is not in the configured keys", activeKeyID)
+	}
+
+	encryptionKeys = ring
+	return nil
+}
+
+// EncryptSecret envelope-encrypts a value with a fresh data key wrapped by the active master key.
+func EncryptSecret(plaintext string) (string, error) {
+	if encryptionKeys == nil {
+		return "", errors.New("encryption is not initialized")
+	}
+	kid := encryptionKeys.activeID
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := sealAESGCM(encryptionKeys.keys[kid], dataKey, []byte(kid))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := sealAESGCM(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedSecretPrefix + kid + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptSecret reverses EncryptSecret. Values without the encrypted prefix are returned unchanged
+// so rows written before encryption was introduced keep working until they are re-encrypted.
+func DecryptSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedSecretPrefix) {
+		return value, nil
+	}
+	if encryptionKeys == nil {
+		return "", errors.New("encryption is not initialized")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, encryptedSecretPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted secret")
+	}
+	kid := parts[0]
+	masterKey, ok := encryptionKeys.keys[kid]
+	if !ok {
+		return "", fmt.Errorf("unknown encryption key id %q", kid)
+	}
+
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed wrapped data key: %w", err)
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed ciphertext: %w", err)
+	}
+
+	dataKey, err := openAESGCM(masterKey, wrappedKey, []byte(kid))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	plaintext, err := openAESGCM(dataKey, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEncryptedSecret reports whether a stored value was written by EncryptSecret.
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// SecretNeedsRotation reports whether a stored value is plaintext or was encrypted with a key other than the active one.
+func SecretNeedsRotation(value string) bool {
+	if !strings.HasPrefix(value, encryptedSecretPrefix) {
+		return true
+	}
+	kid, _, _ := strings.Cut(strings.TrimPrefix(value, encryptedSecretPrefix), ":")
+	return encryptionKeys == nil || kid != encryptionKeys.activeID
+}
+
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func openAESGCM(key, sealed, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,149 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Access and MFA tokens are signed with Ed25519 (alg EdDSA). Every token names its signing key in the
+// kid header, so new keys can be introduced while tokens signed with the previous one are still valid.
+type jwtKeyring struct {
+	signingKey ed25519.PrivateKey
+	activeID   string
+	verifyKeys map[string]ed25519.PublicKey
+}
+
+var jwtKeys *jwtKeyring
+
+// InitJWTKeys loads signing material. signingSpec holds "kid:base64seed" pairs of 32 byte Ed25519 seeds,
+// and the key named activeKeyID signs new tokens. verifySpec optionally adds "kid:base64publickey" pairs for
+// retired keys whose private half is no longer deployed (the "x" value from the JWKS works as-is). All listed keys are accepted for verification.
+func InitJWTKeys(signingSpec, verifySpec, activeKeyID string) error {
+	ring := &jwtKeyring{activeID: activeKeyID, verifyKeys: make(map[string]ed25519.PublicKey)}
+
+	err := parseKeySpec(signingSpec, ed25519.SeedSize, func(kid string, seed []byte) {
+		key := ed25519.NewKeyFromSeed(seed)
+		ring.verifyKeys[kid] = key.Public().(ed25519.PublicKey)
+		if kid == activeKeyID {
+			ring.signingKey = key
+		}
+	})
+	if err != nil {
+		return err
+	}
+	err = parseKeySpec(verifySpec, ed25519.PublicKeySize, func(kid string, public []byte) {
+		if _, ok := ring.verifyKeys[kid]; !ok {
+			ring.verifyKeys[kid] = ed25519.PublicKey(public)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if ring.signingKey == nil {
+		return fmt.Errorf("active JWT key %q is not among the configured signing keys", activeKeyID)
+	}
+
+	jwtKeys = ring
+	return nil
+}
+
+func parseKeySpec(spec string, size int, add func(kid string, key []byte)) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, encoded, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" {
+			return fmt.Errorf("invalid JWT key entry %q, expected kid:base64key", entry)
+		}
+		// Public keys copied from the JWKS are base64url, everything else is standard base64
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			key, err = base64.RawURLEncoding.DecodeString(encoded)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid base64 for JWT key %q: %w", kid, err)
+		}
+		if len(key) != size {
+			return fmt.Errorf("JWT key %q must be %d bytes, got %d", kid, size, len(key))
+		}
+		add(kid, key)
+	}
+	return nil
+}
+
+// GenerateJWTKey returns a new Ed25519 seed in the format expected by InitJWTKeys.
+func GenerateJWTKey() (string, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(seed), nil
+}
+
+// SignJWT signs the claims with the active key.
+func SignJWT(claims jwt.MapClaims) (string, error) {
+	if jwtKeys == nil {
+		return "", errors.New("JWT keys are not initialized")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = jwtKeys.activeID
+	return token.SignedString(jwtKeys.signingKey)
+}
+
+// ParseJWT verifies a token against the key named in its kid header and returns its claims.
+func ParseJWT(tokenString string) (jwt.MapClaims, error) {
+	if jwtKeys == nil {
+		return nil, errors.New("JWT keys are not initialized")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := jwtKeys.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key")
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	return claims, nil
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set.
+func JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	if jwtKeys != nil {
+		kids := make([]string, 0, len(jwtKeys.verifyKeys))
+		for kid := range jwtKeys.verifyKeys {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+		for _, kid := range kids {
+			keys = append(keys, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"alg": jwt.SigningMethodEdDSA.Alg(),
+				"use": "sig",
+				"kid": kid,
+				"x":   base64.RawURLEncoding.EncodeToString(jwtKeys.verifyKeys[kid]),
+			})
+		}
+	}
+	return map[string]interface{}{"keys": keys}
+}